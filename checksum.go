@@ -0,0 +1,88 @@
+package zsync
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// MismatchAction defines what to do with the output when its checksum doesn't match the expected one
+type MismatchAction int
+
+const (
+	// KeepMismatchedOutput leaves the output untouched
+	KeepMismatchedOutput MismatchAction = iota
+	// RemoveMismatchedOutput deletes the output file
+	RemoveMismatchedOutput
+	// QuarantineMismatchedOutput renames the output file appending the QuarantineSuffix to it
+	QuarantineMismatchedOutput
+)
+
+const QuarantineSuffix = ".corrupt"
+
+type ChecksumMismatchError struct {
+	Expected string
+	Actual   string
+
+	// location of the quarantined output, empty if the output wasn't quarantined
+	QuarantinePath string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected SHA-1 %s got %s", e.Expected, e.Actual)
+}
+
+// hashedWriteSeeker computes the checksum of the data written to the output, writes are expected to be sequential
+type hashedWriteSeeker struct {
+	output io.WriteSeeker
+	hash   hash.Hash
+}
+
+func (h *hashedWriteSeeker) Write(p []byte) (n int, err error) {
+	n, err = h.output.Write(p)
+	h.hash.Write(p[:n])
+
+	return n, err
+}
+
+func (h *hashedWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	return h.output.Seek(offset, whence)
+}
+
+func (h *hashedWriteSeeker) SumHex() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+func (zsync *ZSync) verifyChecksum(output io.WriteSeeker, actual string) error {
+	if zsync.SHA1 == "" || strings.EqualFold(zsync.SHA1, actual) {
+		return nil
+	}
+
+	mismatchErr := &ChecksumMismatchError{Expected: zsync.SHA1, Actual: actual}
+
+	namedOutput, ok := output.(interface{ Name() string })
+	if !ok {
+		return mismatchErr
+	}
+
+	switch zsync.OnChecksumMismatch {
+	case RemoveMismatchedOutput:
+		err := os.Remove(namedOutput.Name())
+		if err != nil {
+			return fmt.Errorf("%w, unable to remove output: %v", mismatchErr, err)
+		}
+	case QuarantineMismatchedOutput:
+		quarantinePath := namedOutput.Name() + QuarantineSuffix
+		err := os.Rename(namedOutput.Name(), quarantinePath)
+		if err != nil {
+			return fmt.Errorf("%w, unable to quarantine output: %v", mismatchErr, err)
+		}
+
+		mismatchErr.QuarantinePath = quarantinePath
+	}
+
+	return mismatchErr
+}
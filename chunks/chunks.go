@@ -84,15 +84,21 @@ func LoadChecksumsFromReaderLegacy(
 }
 
 // Required for zsync legacy support
+// The legacy format stores the trailing bytes of the big endian (a, b) rsum pair, they are expanded into the
+// little endian layout produced by rollinghash.RollingHash.PutSum. Missing bytes are set to 0.
 func TransformToInternalRepresentation(inWeakBuffer []byte) []byte {
-	weakBuffer := make([]byte, 4)
+	rsum := make([]byte, 4)
+	copy(rsum[4-len(inWeakBuffer):], inWeakBuffer)
 
-	// reverse bytes order
-	for i, c := range inWeakBuffer {
-		weakBuffer[3-i] = c
-	}
+	return []byte{rsum[1], rsum[0], rsum[3], rsum[2]}
+}
+
+// Required for zsync legacy support
+// Reverts TransformToInternalRepresentation keeping only the last weakHashSize bytes of the rsum
+func TransformToLegacyRepresentation(weakBuffer []byte, weakHashSize int) []byte {
+	rsum := []byte{weakBuffer[1], weakBuffer[0], weakBuffer[3], weakBuffer[2]}
 
-	return weakBuffer
+	return rsum[4-weakHashSize:]
 }
 
 // satisfies filechecksum.ChecksumLookup
@@ -103,7 +109,9 @@ func (s StrongChecksumGetter) GetStrongChecksumForBlock(blockID int) []byte {
 }
 
 type ChunkInfo struct {
-	Size         int64
+	Size int64
+	// seed the chunk was found in, nil for the chunks of the remote file and the ones found by a search that closes
+	// its seed
 	Source       io.ReadSeeker
 	SourceOffset int64
 	TargetOffset int64
@@ -66,6 +66,12 @@ func (mapper *ChunksMapper) GetMissingChunks() []chunks.ChunkInfo {
 	return missingChunkList
 }
 
+// Add maps chunk to its target offset. Only one chunk is kept per target offset, the first one added, so chunks
+// found in several seeds are read from the first seed scanned.
 func (mapper *ChunksMapper) Add(chunk chunks.ChunkInfo) {
+	if _, ok := mapper.chunksMap[chunk.TargetOffset]; ok {
+		return
+	}
+
 	mapper.chunksMap[chunk.TargetOffset] = chunk
 }
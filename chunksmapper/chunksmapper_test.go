@@ -3,6 +3,7 @@ package chunksmapper
 import (
 	"github.com/AppImageCrafters/libzsync-go/chunks"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -30,3 +31,22 @@ func TestFileChunksMapper_GetMissingChunks(t *testing.T) {
 	}
 	assert.Equal(t, expected, result)
 }
+
+func TestFileChunksMapper_AddOverlappingSeeds(t *testing.T) {
+	mapper := NewFileChunksMapper(6)
+	firstSeed := strings.NewReader("abcd")
+	secondSeed := strings.NewReader("cdef")
+
+	mapper.Add(chunks.ChunkInfo{TargetOffset: 0, SourceOffset: 0, Size: 2, Source: firstSeed})
+	mapper.Add(chunks.ChunkInfo{TargetOffset: 2, SourceOffset: 2, Size: 2, Source: firstSeed})
+	mapper.Add(chunks.ChunkInfo{TargetOffset: 2, SourceOffset: 0, Size: 2, Source: secondSeed})
+	mapper.Add(chunks.ChunkInfo{TargetOffset: 4, SourceOffset: 2, Size: 2, Source: secondSeed})
+
+	expected := []chunks.ChunkInfo{
+		{TargetOffset: 0, SourceOffset: 0, Size: 2, Source: firstSeed},
+		{TargetOffset: 2, SourceOffset: 2, Size: 2, Source: firstSeed},
+		{TargetOffset: 4, SourceOffset: 2, Size: 2, Source: secondSeed},
+	}
+	assert.Equal(t, expected, mapper.GetMappedChunks())
+	assert.Nil(t, mapper.GetMissingChunks())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/AppImageCrafters/libzsync-go"
+	"github.com/AppImageCrafters/libzsync-go/control"
+	"github.com/AppImageCrafters/libzsync-go/sources"
+)
+
+// reads the control file from a url or a local path, relative urls are resolved against the control file url or
+// the referrer if given. The parser diagnostics are sent to logger, if not nil.
+func loadControl(ctx context.Context, source string, referrer string, keepPath string, logger control.Logger) (
+	*zsync.ZSync, *control.Control, error) {
+	var data []byte
+	var err error
+	if isUrl(source) {
+		data, err = downloadControl(ctx, source)
+		if referrer == "" {
+			referrer = source
+		}
+	} else {
+		data, err = ioutil.ReadFile(source)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read control file: %s", err.Error())
+	}
+
+	if keepPath != "" {
+		err = ioutil.WriteFile(keepPath, data, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to save control file: %s", err.Error())
+		}
+	}
+
+	zsyncControl, err := control.ReadControlWithLogger(bytes.NewReader(data), logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sync := zsync.NewZSyncFromControl(zsyncControl)
+	if referrer != "" {
+		err = sync.ResolveUrls(referrer)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if !isUrl(sync.RemoteFileUrl) {
+		return nil, nil, fmt.Errorf("relative url \"%s\" in control file, use -u to set the control file url",
+			sync.RemoteFileUrl)
+	}
+
+	sync.RetryPolicy = &sources.DefaultRetryPolicy
+	sync.RangesFallback = zsync.StreamMissingRanges
+
+	return sync, zsyncControl, nil
+}
+
+func downloadControl(ctx context.Context, controlUrl string) ([]byte, error) {
+	var client *sources.HttpClient
+	response, err := client.Get(ctx, controlUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from \"%s\": %s", controlUrl, response.Status)
+	}
+
+	return ioutil.ReadAll(response.Body)
+}
+
+func isUrl(value string) bool {
+	parsedUrl, err := url.Parse(value)
+	return err == nil && (parsedUrl.Scheme == "http" || parsedUrl.Scheme == "https")
+}
@@ -0,0 +1,176 @@
+// Command zsync-go downloads the file described by a zsync control file reusing the data of local seed files. It
+// accepts the options of the zsync C client and exits with the same codes.
+//
+// The output is written to <output>.part, which is reused by the next run if the download fails. Once the download is
+// complete, the previous output is kept as <output>.zs-old and <output>.part is renamed to <output>.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/AppImageCrafters/libzsync-go"
+	"github.com/AppImageCrafters/libzsync-go/control"
+)
+
+const (
+	exitOk = 0
+	// invalid usage or unusable control file, seeds or output
+	exitError = 1
+	// the output doesn't match the control file checksum
+	exitChecksumMismatch = 2
+	// the missing data couldn't be downloaded
+	exitDownloadFailed = 3
+)
+
+const usage = `Usage: zsync-go [-i seed]... [-o output] [-u url] [-k file.zsync] [-v] {url|file.zsync}
+
+`
+
+// seedList collects the repeated -i flags
+type seedList []string
+
+func (s *seedList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *seedList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	code := run(ctx, os.Args[1:], os.Stderr)
+	cancel()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("zsync-go", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		_, _ = fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	var seeds seedList
+	flags.Var(&seeds, "i", "seed `file`, can be repeated")
+	outputPath := flags.String("o", "", "output `file`, the control file Filename header is used by default")
+	referrer := flags.String("u", "", "`url` the control file was downloaded from, relative urls are resolved against it")
+	keepPath := flags.String("k", "", "save the downloaded control file to `file`")
+	verbose := flags.Bool("v", false, "print the progress and the control file warnings")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return exitError
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	var logger control.Logger
+	if *verbose {
+		logger = log.New(stderr, "", 0)
+	}
+
+	sync, zsyncControl, err := loadControl(ctx, flags.Arg(0), *referrer, *keepPath, logger)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	if *outputPath == "" {
+		*outputPath = defaultOutputPath(zsyncControl.FileName, sync.RemoteFileUrl)
+		if *outputPath == "" {
+			_, _ = fmt.Fprintln(stderr, "the control file doesn't name the output file, use -o to set it")
+			return exitError
+		}
+	}
+
+	if *verbose {
+		sync.Observer = &progressPrinter{output: stderr, total: sync.RemoteFileSize}
+	}
+
+	return syncOutput(ctx, sync, seeds, *outputPath, stderr)
+}
+
+// the base name of the control file Filename or else of the remote file url, as the zsync client does. It's empty if
+// neither names a file.
+func defaultOutputPath(fileName string, remoteFileUrl string) string {
+	name := filepath.Base(fileName)
+	if fileName == "" {
+		parsedUrl, err := url.Parse(remoteFileUrl)
+		if err != nil {
+			return ""
+		}
+
+		name = path.Base(parsedUrl.Path)
+	}
+
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+
+	return name
+}
+
+func syncOutput(ctx context.Context, sync *zsync.ZSync, seeds []string, outputPath string, stderr io.Writer) int {
+	partPath := outputPath + zsync.PartialSuffix
+	for _, seed := range seeds {
+		info, err := os.Stat(seed)
+		if err == nil && info.IsDir() {
+			err = fmt.Errorf("%s is a directory", seed)
+		}
+
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "unable to read seed: %s\n", err.Error())
+			return exitError
+		}
+	}
+
+	// the previous output is reused, the blocks of an interrupted download are reused by SyncSeedsToFileContext
+	if _, err := os.Stat(outputPath); err == nil {
+		seeds = append(seeds, outputPath)
+	}
+
+	sync.KeepBackup = true
+	_, err := sync.SyncSeedsToFileContext(ctx, seeds, outputPath)
+
+	var mismatchErr *zsync.ChecksumMismatchError
+	if errors.As(err, &mismatchErr) {
+		_, _ = fmt.Fprintf(stderr, "%s\nAborting, download available in %s\n", err.Error(), partPath)
+		return exitChecksumMismatch
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "failed to retrieve all remaining blocks: %s\nIncomplete transfer left in %s\n",
+			err.Error(), partPath)
+		return exitDownloadFailed
+	}
+
+	return exitOk
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AppImageCrafters/libzsync-go/control"
+	"github.com/stretchr/testify/assert"
+)
+
+type testEnvironment struct {
+	dir         string
+	content     []byte
+	controlFile []byte
+	server      *httptest.Server
+	// requests of the remote file
+	fileRequests int32
+	fileMissing  bool
+}
+
+func newTestEnvironment(t *testing.T) *testEnvironment {
+	dir, err := ioutil.TempDir("", "zsync-go")
+	assert.Nil(t, err)
+
+	env := &testEnvironment{dir: dir, content: make([]byte, 2048*5)}
+	rand.New(rand.NewSource(1)).Read(env.content)
+
+	var controlFile bytes.Buffer
+	err = control.Make(bytes.NewReader(env.content), int64(len(env.content)), &controlFile,
+		control.MakeOptions{FileName: "file.bin"})
+	assert.Nil(t, err)
+	env.controlFile = controlFile.Bytes()
+
+	env.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file.bin.zsync":
+			_, _ = w.Write(env.controlFile)
+		case "/file.bin":
+			atomic.AddInt32(&env.fileRequests, 1)
+			if env.fileMissing {
+				http.NotFound(w, r)
+				return
+			}
+
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(env.content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return env
+}
+
+func (e *testEnvironment) close() {
+	e.server.Close()
+	_ = os.RemoveAll(e.dir)
+}
+
+func (e *testEnvironment) path(name string) string {
+	return filepath.Join(e.dir, name)
+}
+
+func (e *testEnvironment) writeFile(t *testing.T, name string, data []byte) string {
+	assert.Nil(t, ioutil.WriteFile(e.path(name), data, 0644))
+	return e.path(name)
+}
+
+func (e *testEnvironment) run(args ...string) (int, string) {
+	var stderr bytes.Buffer
+	code := run(context.Background(), args, &stderr)
+	return code, stderr.String()
+}
+
+func (e *testEnvironment) assertOutput(t *testing.T, name string) {
+	output, err := ioutil.ReadFile(e.path(name))
+	assert.Nil(t, err)
+	assert.Equal(t, e.content, output)
+
+	_, err = os.Stat(e.path(name) + ".part")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRun(t *testing.T) {
+	env := newTestEnvironment(t)
+	defer env.close()
+
+	// the first and last blocks changed
+	seed := append([]byte{}, env.content...)
+	seed[0]++
+	seed[len(seed)-1]++
+	seedPath := env.writeFile(t, "seed", seed)
+
+	code, stderr := env.run("-i", seedPath, "-o", env.path("output"), "-k", env.path("file.bin.zsync"), "-v",
+		env.server.URL+"/file.bin.zsync")
+
+	assert.Equal(t, exitOk, code, stderr)
+	env.assertOutput(t, "output")
+	assert.Contains(t, stderr, "Used 6144 local, fetched 4096")
+
+	savedControl, _ := ioutil.ReadFile(env.path("file.bin.zsync"))
+	assert.Equal(t, env.controlFile, savedControl)
+}
+
+func TestRunLocalControlFile(t *testing.T) {
+	env := newTestEnvironment(t)
+	defer env.close()
+
+	controlPath := env.writeFile(t, "file.bin.zsync", env.controlFile)
+
+	code, stderr := env.run("-o", env.path("output"), controlPath)
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "-u")
+
+	code, stderr = env.run("-o", env.path("output"), "-u", env.server.URL+"/file.bin.zsync", controlPath)
+	assert.Equal(t, exitOk, code, stderr)
+	env.assertOutput(t, "output")
+}
+
+func TestRunResume(t *testing.T) {
+	env := newTestEnvironment(t)
+	defer env.close()
+
+	// an interrupted download and the previous version are reused
+	env.writeFile(t, "output.part", env.content[:2048*3])
+	env.writeFile(t, "output", env.content[2048*3:])
+
+	code, stderr := env.run("-o", env.path("output"), env.server.URL+"/file.bin.zsync")
+	assert.Equal(t, exitOk, code, stderr)
+	env.assertOutput(t, "output")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&env.fileRequests))
+
+	previous, _ := ioutil.ReadFile(env.path("output.zs-old"))
+	assert.Equal(t, env.content[2048*3:], previous)
+
+	_, err := os.Stat(env.path("output.part"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunMultipleSeeds(t *testing.T) {
+	env := newTestEnvironment(t)
+	defer env.close()
+
+	firstHalf := env.writeFile(t, "first", env.content[:2048*2])
+	secondHalf := env.writeFile(t, "second", env.content[2048*2:])
+
+	code, stderr := env.run("-i", firstHalf, "-i", secondHalf, "-o", env.path("output"),
+		env.server.URL+"/file.bin.zsync")
+	assert.Equal(t, exitOk, code, stderr)
+	env.assertOutput(t, "output")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&env.fileRequests))
+}
+
+func TestRunExitCodes(t *testing.T) {
+	env := newTestEnvironment(t)
+	defer env.close()
+
+	code, _ := env.run()
+	assert.Equal(t, exitError, code)
+
+	code, _ = env.run("-i", env.path("missing"), env.server.URL+"/file.bin.zsync")
+	assert.Equal(t, exitError, code)
+
+	code, _ = env.run(env.server.URL + "/missing.zsync")
+	assert.Equal(t, exitError, code)
+
+	// wrong checksum
+	env.controlFile = regexp.MustCompile("SHA-1: [0-9a-f]+").ReplaceAll(env.controlFile,
+		[]byte("SHA-1: "+strings.Repeat("0", 40)))
+	code, stderr := env.run("-o", env.path("output"), env.server.URL+"/file.bin.zsync")
+	assert.Equal(t, exitChecksumMismatch, code, stderr)
+	_, err := os.Stat(env.path("output.part"))
+	assert.Nil(t, err)
+
+	env.fileMissing = true
+	code, stderr = env.run("-o", env.path("other"), env.server.URL+"/file.bin.zsync")
+	assert.Equal(t, exitDownloadFailed, code, stderr)
+	assert.Contains(t, stderr, "other.part")
+}
+
+func TestDefaultOutputPath(t *testing.T) {
+	assert.Equal(t, "file.bin", defaultOutputPath("../dir/file.bin", "http://example.com/other"))
+	assert.Equal(t, "file.bin", defaultOutputPath("", "http://example.com/dir/file.bin?version=2"))
+	assert.Equal(t, "", defaultOutputPath("", "http://example.com/"))
+	assert.Equal(t, "", defaultOutputPath("", "http://example.com"))
+}
+
+func TestRunWithoutFilename(t *testing.T) {
+	env := newTestEnvironment(t)
+	defer env.close()
+
+	workingDir, _ := os.Getwd()
+	assert.Nil(t, os.Chdir(env.dir))
+	defer func() { _ = os.Chdir(workingDir) }()
+
+	// the output is named after the remote file
+	var controlFile bytes.Buffer
+	_ = control.Make(bytes.NewReader(env.content), int64(len(env.content)), &controlFile,
+		control.MakeOptions{URL: "file.bin"})
+	env.controlFile = controlFile.Bytes()
+
+	code, stderr := env.run(env.server.URL + "/file.bin.zsync")
+	assert.Equal(t, exitOk, code, stderr)
+	env.assertOutput(t, "file.bin")
+
+	controlFile.Reset()
+	_ = control.Make(bytes.NewReader(env.content), int64(len(env.content)), &controlFile,
+		control.MakeOptions{URL: "/"})
+	env.controlFile = controlFile.Bytes()
+
+	code, stderr = env.run(env.server.URL + "/file.bin.zsync")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "-o")
+}
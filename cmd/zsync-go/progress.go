@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/AppImageCrafters/libzsync-go"
+	"github.com/AppImageCrafters/libzsync-go/chunks"
+)
+
+// progressPrinter is a zsync.ProgressObserver that prints the sync progress
+type progressPrinter struct {
+	output io.Writer
+	total  int64
+
+	mutex       sync.Mutex
+	missing     int64
+	downloaded  int64
+	received    map[int64]int64
+	lastPercent int64
+}
+
+func (p *progressPrinter) OnSeedScanned(n int64) {}
+
+func (p *progressPrinter) OnChunkMatched(chunk chunks.ChunkInfo) {}
+
+func (p *progressPrinter) OnSyncPlanned(reusedBytes int64, missingBytes int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.missing = missingBytes
+	p.received = map[int64]int64{}
+	p.lastPercent = -1
+	_, _ = fmt.Fprintf(p.output, "Read seeds. Target %.1f%% complete.\n", percentage(reusedBytes, p.total))
+}
+
+func (p *progressPrinter) OnDownloadProgress(rangeBegin int64, rangeEnd int64, received int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// received is the total of the range so far
+	p.downloaded += received - p.received[rangeBegin]
+	p.received[rangeBegin] = received
+	if received == rangeEnd-rangeBegin {
+		delete(p.received, rangeBegin)
+	}
+
+	percent := int64(percentage(p.downloaded, p.missing))
+	if percent != p.lastPercent {
+		p.lastPercent = percent
+		_, _ = fmt.Fprintf(p.output, "\rDownloading %d/%d bytes (%d%%)", p.downloaded, p.missing, percent)
+	}
+}
+
+func (p *progressPrinter) OnSyncFinished(totals zsync.SyncTotals) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.lastPercent >= 0 {
+		_, _ = fmt.Fprintln(p.output)
+	}
+
+	_, _ = fmt.Fprintf(p.output, "Used %d local, fetched %d (%s).\n", totals.ReusedBytes, totals.DownloadedBytes,
+		totals.Strategy)
+}
+
+func percentage(value int64, total int64) float64 {
+	if total == 0 {
+		return 100
+	}
+
+	return float64(value) * 100 / float64(total)
+}
@@ -6,6 +6,8 @@ Control provides parser for the zsync control (.zsync) files.
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"strconv"
@@ -22,23 +24,96 @@ type ControlHeaderHashLengths struct {
 }
 
 type Control struct {
-	Version     string
+	Version string
+	// oldest zsync version able to use the file
+	MinVersion  string
 	MTime       string
 	FileName    string
 	Blocks      uint
 	BlockSize   uint
 	FileLength  int64
 	HashLengths ControlHeaderHashLengths
-	URL         string
-	SHA1        string
+	// first URL header, it replaces URLs[0] when set. See AllURLs
+	URL string
+	// every URL header, in order of appearance
+	URLs []string
+	SHA1 string
+
+	// The compressed version of the file, it can be downloaded and decompressed using ZMap2 when the file itself is
+	// not available. The Z-URL headers, in order of appearance
+	ZURLs     []string
+	ZFileName string
+	// maps the blocks of the compressed file to the file, see ZMapEntry
+	ZMap2 []ZMapEntry
+	// the command used to compress the file again once it is downloaded, i.e. "gzip -n --best"
+	Recompress string
+	// the unknown headers that can be safely ignored
+	Safe []string
+
+	// unknown headers, in order of appearance
+	Extra Headers
+
+	// keys of the parsed header lines, in order of appearance, WriteTo follows it
+	headerOrder []string
 
 	ChecksumIndex *index.ChecksumIndex
 }
 
+// AllURLs returns URLs with URL in place of the first one, so setting URL alone changes the main URL. The others are
+// mirrors.
+func (control *Control) AllURLs() []string {
+	if control.URL == "" {
+		return control.URLs
+	}
+
+	if len(control.URLs) == 0 {
+		return []string{control.URL}
+	}
+
+	return append([]string{control.URL}, control.URLs[1:]...)
+}
+
+// ZMapEntry maps a position of the compressed file to the uncompressed data, as the Z-Map2 header
+type ZMapEntry struct {
+	InBitOffset   uint16
+	OutByteOffset uint16
+}
+
+// Header is a control file header, the key keeps its original case
+type Header struct {
+	Key   string
+	Value string
+}
+
+// Headers keeps the headers in order of appearance
+type Headers []Header
+
+// Get returns the value of the first header named key, the key is case insensitive
+func (headers Headers) Get(key string) (string, bool) {
+	for _, header := range headers {
+		if strings.EqualFold(header.Key, key) {
+			return header.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// Logger receives the diagnostics of the parser, *log.Logger implements it
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
 func ReadControl(input io.Reader) (control *Control, err error) {
+	return ReadControlWithLogger(input, nil)
+}
+
+// ReadControlWithLogger is like ReadControl but the diagnostics, like unknown headers or invalid values, are sent to
+// logger. They are discarded if logger is nil.
+func ReadControlWithLogger(input io.Reader, logger Logger) (control *Control, err error) {
 	control = &Control{}
 	reader := bufio.NewReader(input)
-	err = control.readHeaders(reader)
+	err = control.readHeaders(reader, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +123,7 @@ func ReadControl(input io.Reader) (control *Control, err error) {
 	return
 }
 
-func (control *Control) readHeaders(reader *bufio.Reader) error {
+func (control *Control) readHeaders(reader *bufio.Reader, logger Logger) error {
 	for {
 		line, err := reader.ReadString('\n')
 		if err != nil {
@@ -61,42 +136,120 @@ func (control *Control) readHeaders(reader *bufio.Reader) error {
 		}
 
 		k, v := parseHeaderLine(line)
-		setHeaderValue(control, k, v)
+		control.headerOrder = append(control.headerOrder, k)
+		// the Z-Map2 entries follow its header line
+		if strings.EqualFold(k, "z-map2") {
+			entries, err := readZMap2(reader, v)
+			if err != nil {
+				return err
+			}
+
+			control.ZMap2 = entries
+			continue
+		}
+
+		setHeaderValue(control, k, v, logger)
 	}
 	return nil
 }
 
-func setHeaderValue(c *Control, k string, v string) {
-	switch k {
+func setHeaderValue(c *Control, k string, v string, logger Logger) {
+	var err error
+	switch strings.ToLower(k) {
 	case "zsync":
 		c.Version = v
+	case "min-version":
+		c.MinVersion = v
 	case "filename":
 		c.FileName = v
 	case "mtime":
 		c.MTime = v
 	case "blocksize":
-		vi, err := strconv.ParseUint(v, 10, 0)
+		var vi uint64
+		vi, err = strconv.ParseUint(v, 10, 0)
 		if err == nil {
 			c.BlockSize = uint(vi)
 		}
 
 	case "length":
-		vi, err := strconv.ParseInt(v, 10, 0)
+		var vi int64
+		vi, err = strconv.ParseInt(v, 10, 0)
 		if err == nil {
 			c.FileLength = vi
 		}
 	case "hash-lengths":
-		hashLenghts, err := parseHashLengths(v)
+		var hashLenghts *ControlHeaderHashLengths
+		hashLenghts, err = parseHashLengths(v)
 		if err == nil {
 			c.HashLengths = *hashLenghts
 		}
 	case "url":
-		c.URL = v
+		if c.URL == "" {
+			c.URL = v
+		}
+		c.URLs = append(c.URLs, v)
 	case "sha-1":
 		c.SHA1 = v
+	case "z-url":
+		c.ZURLs = append(c.ZURLs, v)
+	case "z-filename":
+		c.ZFileName = v
+	case "recompress":
+		c.Recompress = v
+	case "safe":
+		c.Safe = append(c.Safe, strings.Fields(v)...)
 	default:
-		fmt.Println("Unknown zsync control key: " + k)
+		c.Extra = append(c.Extra, Header{Key: k, Value: v})
+		if !c.isSafe(k) {
+			logf(logger, "unknown zsync control header %q", k)
+		}
 	}
+
+	if err != nil {
+		logf(logger, "invalid zsync control header %q: %s", k, err.Error())
+	}
+}
+
+// an unknown header can be ignored if it was listed in a previous Safe header
+func (control *Control) isSafe(key string) bool {
+	for _, safe := range control.Safe {
+		if strings.EqualFold(safe, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func logf(logger Logger, format string, v ...interface{}) {
+	if logger != nil {
+		logger.Printf(format, v...)
+	}
+}
+
+// reads the entries announced by a Z-Map2 header, each one is made of two big endian uint16
+func readZMap2(reader io.Reader, count string) ([]ZMapEntry, error) {
+	n, err := strconv.ParseUint(count, 10, 31)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Z-Map2 header: %s", err.Error())
+	}
+
+	// grows with the data read instead of trusting the header
+	var buf bytes.Buffer
+	_, err = io.CopyN(&buf, reader, int64(n*4))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the Z-Map2 entries: %s", err.Error())
+	}
+
+	data := buf.Bytes()
+
+	entries := make([]ZMapEntry, n)
+	for i := range entries {
+		entries[i].InBitOffset = binary.BigEndian.Uint16(data[i*4:])
+		entries[i].OutByteOffset = binary.BigEndian.Uint16(data[i*4+2:])
+	}
+
+	return entries, nil
 }
 
 func parseHashLengths(s string) (hashLengths *ControlHeaderHashLengths, err error) {
@@ -124,24 +277,34 @@ func parseHashLengths(s string) (hashLengths *ControlHeaderHashLengths, err erro
 		StrongCheckSumBytes:    hashLengthsArray[2],
 	}
 
+	err = hashLengths.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return hashLengths, nil
+}
+
+func (hashLengths ControlHeaderHashLengths) validate() error {
+	const errorPrefix = "Invalid Hash-Lengths entry"
 	if hashLengths.ConsecutiveMatchNeeded < 1 || hashLengths.ConsecutiveMatchNeeded > 2 {
-		return nil, fmt.Errorf(errorPrefix + ": ConsecutiveMatchNeeded must be in rage [1, 2] ")
+		return fmt.Errorf(errorPrefix + ": ConsecutiveMatchNeeded must be in rage [1, 2] ")
 	}
 
 	if hashLengths.WeakCheckSumBytes < 1 || hashLengths.WeakCheckSumBytes > 4 {
-		return nil, fmt.Errorf(errorPrefix + ": WeakCheckSumBytes must be in rage [1, 4] ")
+		return fmt.Errorf(errorPrefix + ": WeakCheckSumBytes must be in rage [1, 4] ")
 	}
 
 	if hashLengths.StrongCheckSumBytes < 3 || hashLengths.StrongCheckSumBytes > 16 {
-		return nil, fmt.Errorf(errorPrefix + ": StrongCheckSumBytes must be in rage [4, 16] ")
+		return fmt.Errorf(errorPrefix + ": StrongCheckSumBytes must be in rage [4, 16] ")
 	}
 
-	return hashLengths, nil
+	return nil
 }
 
 func parseHeaderLine(line string) (key string, value string) {
 	parts := strings.SplitN(line, ":", 2)
-	key = strings.ToLower(parts[0])
+	key = strings.TrimSpace(parts[0])
 
 	if len(parts) == 2 {
 		value = strings.TrimSpace(parts[1])
@@ -165,6 +328,7 @@ func (control *Control) readChecksums(reader io.Reader) error {
 		control.HashLengths.WeakCheckSumBytes,
 		control.HashLengths.StrongCheckSumBytes)
 
+	control.ChecksumIndex.ConsecutiveMatchNeeded = control.HashLengths.ConsecutiveMatchNeeded
 	control.Blocks = uint(control.ChecksumIndex.BlockCount)
 
 	return nil
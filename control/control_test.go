@@ -2,8 +2,10 @@ package control
 
 import (
 	"bytes"
-	"github.com/stretchr/testify/assert"
+	"log"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestReadControl(t *testing.T) {
@@ -14,6 +16,7 @@ Blocksize: 2048
 Length: 4156
 Hash-Lengths: 2,2,3
 URL: /tmp/appimage-update/file
+URL: http://mirror.example.com/file
 SHA-1: 580c4e0ce970f2f9f311dc782e54127b1fa612ea
 
 `)
@@ -32,6 +35,7 @@ SHA-1: 580c4e0ce970f2f9f311dc782e54127b1fa612ea
 	assert.Equal(t, uint(2), c.HashLengths.WeakCheckSumBytes)
 	assert.Equal(t, uint(3), c.HashLengths.StrongCheckSumBytes)
 	assert.Equal(t, "/tmp/appimage-update/file", c.URL)
+	assert.Equal(t, []string{"/tmp/appimage-update/file", "http://mirror.example.com/file"}, c.URLs)
 	assert.Equal(t, "580c4e0ce970f2f9f311dc782e54127b1fa612ea", c.SHA1)
 
 	assert.Equal(t, uint(3), c.Blocks)
@@ -39,3 +43,53 @@ SHA-1: 580c4e0ce970f2f9f311dc782e54127b1fa612ea
 	assert.NotNil(t, c.ChecksumIndex.FindWeakChecksum2([]byte{0, 0, 1, 1}))
 	assert.NotNil(t, c.ChecksumIndex.FindWeakChecksum2([]byte{0, 0, 2, 2}))
 }
+
+// an empty file compressed with zsyncmake -z, with unknown headers before SHA-1. The Z-Map2 entries contain a '\n'.
+var extensionHeadersControl = append(append([]byte(`zsync: 0.6.2
+Safe: Z-Filename Recompress MTime X-Custom
+Z-Filename: file.gz
+Filename: file
+MTime: Tue, 21 Jul 2020 17:03:30 +0000
+Blocksize: 2048
+Length: 0
+Hash-Lengths: 1,4,16
+Z-URL: file.gz
+Z-URL: http://mirror.example.com/file.gz
+URL: file
+Z-Map2: 2
+`), 0, 1, 0, 2, 0x0a, 0, 0xff, 0xff), []byte(`Recompress: gzip -n --best
+X-Custom: value
+X-Unknown: other
+SHA-1: da39a3ee5e6b4b0d3255bfef95601890afd80709
+
+`)...)
+
+func TestReadControl_ExtensionHeaders(t *testing.T) {
+	var logs bytes.Buffer
+	c, err := ReadControlWithLogger(bytes.NewReader(extensionHeadersControl), log.New(&logs, "", 0))
+	assert.Nil(t, err)
+
+	assert.Equal(t, "file.gz", c.ZFileName)
+	assert.Equal(t, []string{"file.gz", "http://mirror.example.com/file.gz"}, c.ZURLs)
+	assert.Equal(t, "gzip -n --best", c.Recompress)
+	assert.Equal(t, []string{"Z-Filename", "Recompress", "MTime", "X-Custom"}, c.Safe)
+	assert.Equal(t, []ZMapEntry{{InBitOffset: 1, OutByteOffset: 2}, {InBitOffset: 0x0a00, OutByteOffset: 0xffff}},
+		c.ZMap2)
+	assert.Equal(t, Headers{{Key: "X-Custom", Value: "value"}, {Key: "X-Unknown", Value: "other"}}, c.Extra)
+	assert.Equal(t, "da39a3ee5e6b4b0d3255bfef95601890afd80709", c.SHA1)
+
+	value, ok := c.Extra.Get("x-custom")
+	assert.True(t, ok)
+	assert.Equal(t, "value", value)
+
+	// only the headers that aren't safe are reported
+	assert.Equal(t, "unknown zsync control header \"X-Unknown\"\n", logs.String())
+}
+
+func TestReadControl_InvalidZMap2(t *testing.T) {
+	_, err := ReadControl(bytes.NewReader([]byte("zsync: 0.6.2\nZ-Map2: 2\n\x00\x01\n")))
+	assert.NotNil(t, err)
+
+	_, err = ReadControl(bytes.NewReader([]byte("zsync: 0.6.2\nZ-Map2: x\n\n")))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,190 @@
+package control
+
+/**
+Make provides a native implementation of the zsyncmake tool, it generates control (.zsync) files compatible with the
+ones produced by the original C implementation.
+*/
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AppImageCrafters/libzsync-go/chunks"
+	"github.com/AppImageCrafters/libzsync-go/hasedbuffer"
+)
+
+const Version = "0.6.2"
+
+// MakeOptions holds the control file parameters, zero values are replaced by the zsyncmake defaults
+type MakeOptions struct {
+	FileName    string
+	MTime       time.Time
+	URL         string
+	BlockSize   uint
+	HashLengths ControlHeaderHashLengths
+}
+
+// DefaultBlockSize returns the block size used by zsyncmake for a file of the given length
+func DefaultBlockSize(length int64) uint {
+	if length < 100000000 {
+		return 2048
+	}
+
+	return 4096
+}
+
+// DefaultHashLengths returns the hash lengths used by zsyncmake for a file of the given length
+func DefaultHashLengths(length int64, blockSize uint) ControlHeaderHashLengths {
+	if length < 1 {
+		return ControlHeaderHashLengths{ConsecutiveMatchNeeded: 1, WeakCheckSumBytes: 2, StrongCheckSumBytes: 3}
+	}
+
+	seqMatches := 1
+	if length > int64(blockSize) {
+		seqMatches = 2
+	}
+
+	fileBits := math.Log(float64(length)) / math.Log(2)
+	blockBits := math.Log(float64(blockSize)) / math.Log(2)
+	// integer division on purpose, same as zsyncmake
+	blockCountBits := math.Log(float64(1+length/int64(blockSize))) / math.Log(2)
+
+	weakLen := int(math.Ceil((fileBits + blockBits - 8.6) / float64(seqMatches) / 8))
+	if weakLen > 4 {
+		weakLen = 4
+	}
+	if weakLen < 2 {
+		weakLen = 2
+	}
+
+	strongLen := int(math.Ceil((20 + fileBits + blockCountBits) / float64(seqMatches) / 8))
+	strongLen2 := int((7.9 + (20 + blockCountBits)) / 8)
+	if strongLen < strongLen2 {
+		strongLen = strongLen2
+	}
+	if strongLen > 16 {
+		strongLen = 16
+	}
+
+	return ControlHeaderHashLengths{
+		ConsecutiveMatchNeeded: uint(seqMatches),
+		WeakCheckSumBytes:      uint(weakLen),
+		StrongCheckSumBytes:    uint(strongLen),
+	}
+}
+
+// MakeFromFile writes the control file of the file at path into output. The file name and modification time are
+// taken from the file if not set in the options.
+func MakeFromFile(path string, output io.Writer, options MakeOptions) error {
+	input, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	inputStat, err := input.Stat()
+	if err != nil {
+		return err
+	}
+
+	if options.FileName == "" {
+		options.FileName = filepath.Base(path)
+	}
+
+	if options.MTime.IsZero() {
+		options.MTime = inputStat.ModTime()
+	}
+
+	return Make(input, inputStat.Size(), output, options)
+}
+
+// Make reads length bytes from input and writes the control file describing them into output
+func Make(input io.Reader, length int64, output io.Writer, options MakeOptions) error {
+	if options.BlockSize == 0 {
+		options.BlockSize = DefaultBlockSize(length)
+	}
+
+	if options.HashLengths == (ControlHeaderHashLengths{}) {
+		options.HashLengths = DefaultHashLengths(length, options.BlockSize)
+	} else {
+		err := options.HashLengths.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.URL == "" {
+		options.URL = options.FileName
+	}
+
+	fileHash := sha1.New()
+	checksums, readBytes, err := makeChecksums(io.TeeReader(input, fileHash), options)
+	if err != nil {
+		return err
+	}
+
+	if readBytes != length {
+		return fmt.Errorf("input length mismatch, expected: %d read: %d", length, readBytes)
+	}
+
+	control := &Control{
+		Version:     Version,
+		FileName:    options.FileName,
+		BlockSize:   options.BlockSize,
+		FileLength:  length,
+		HashLengths: options.HashLengths,
+		URL:         options.URL,
+		SHA1:        hex.EncodeToString(fileHash.Sum(nil)),
+	}
+	if !options.MTime.IsZero() {
+		control.MTime = options.MTime.UTC().Format(time.RFC1123Z)
+	}
+
+	var headers bytes.Buffer
+	control.writeHeaders(&headers)
+
+	_, err = headers.WriteTo(output)
+	if err != nil {
+		return err
+	}
+
+	_, err = checksums.WriteTo(output)
+	return err
+}
+
+// computes the legacy encoded checksums of every block, the last block is padded with zeros
+func makeChecksums(input io.Reader, options MakeOptions) (checksums *bytes.Buffer, readBytes int64, err error) {
+	checksums = &bytes.Buffer{}
+	blockSize := int64(options.BlockSize)
+	weakLen := int(options.HashLengths.WeakCheckSumBytes)
+	strongLen := int(options.HashLengths.StrongCheckSumBytes)
+
+	buf := hasedbuffer.NewHashedBuffer(int(blockSize))
+	for {
+		n, err := buf.ReadFull(input)
+		if err != nil {
+			return nil, readBytes, err
+		}
+
+		if n == 0 {
+			break
+		}
+
+		readBytes += n
+		checksums.Write(chunks.TransformToLegacyRepresentation(buf.RollingSum(), weakLen))
+		checksums.Write(buf.CheckSum()[:strongLen])
+
+		if n < blockSize {
+			break
+		}
+	}
+
+	return checksums, readBytes, nil
+}
@@ -0,0 +1,117 @@
+package control
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/AppImageCrafters/libzsync-go/hasedbuffer"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/md4"
+)
+
+func makeSampleData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = "0123456789"[(i/2048)%10]
+	}
+
+	return data
+}
+
+func TestMake(t *testing.T) {
+	data := makeSampleData(4156)
+	mTime, _ := time.Parse(time.RFC1123Z, "Tue, 21 Jul 2020 17:03:30 +0000")
+
+	var output bytes.Buffer
+	err := Make(bytes.NewReader(data), int64(len(data)), &output, MakeOptions{FileName: "file", MTime: mTime})
+	assert.Nil(t, err)
+
+	expected := []byte(`zsync: 0.6.2
+Filename: file
+MTime: Tue, 21 Jul 2020 17:03:30 +0000
+Blocksize: 2048
+Length: 4156
+Hash-Lengths: 2,2,3
+URL: file
+SHA-1: 580c4e0ce970f2f9f311dc782e54127b1fa612ea
+
+`)
+	weakSums := [][]byte{{0xc0, 0x00}, {0xc4, 0x00}, {0x66, 0x4c}}
+	for i, weakSum := range weakSums {
+		block := make([]byte, 2048)
+		copy(block, data[i*2048:])
+		strongSum := md4.New()
+		strongSum.Write(block)
+
+		expected = append(expected, weakSum...)
+		expected = append(expected, strongSum.Sum(nil)[:3]...)
+	}
+
+	assert.Equal(t, expected, output.Bytes())
+}
+
+func TestMake_ReadBack(t *testing.T) {
+	data := makeSampleData(2048*5 + 100)
+	hashLengths := ControlHeaderHashLengths{ConsecutiveMatchNeeded: 1, WeakCheckSumBytes: 4, StrongCheckSumBytes: 16}
+
+	var output bytes.Buffer
+	err := Make(bytes.NewReader(data), int64(len(data)), &output,
+		MakeOptions{URL: "http://localhost/file", HashLengths: hashLengths})
+	assert.Nil(t, err)
+
+	c, err := ReadControl(&output)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "http://localhost/file", c.URL)
+	assert.Equal(t, int64(len(data)), c.FileLength)
+	assert.Equal(t, hashLengths, c.HashLengths)
+	assert.Equal(t, uint(6), c.Blocks)
+	assert.NotNil(t, c.ChecksumIndex.FindWeakChecksum2([]byte{0x00, 0x80, 0x00, 0xc0}))
+}
+
+func TestMake_LengthMismatch(t *testing.T) {
+	data := makeSampleData(100)
+
+	var output bytes.Buffer
+	err := Make(bytes.NewReader(data), 200, &output, MakeOptions{})
+	assert.NotNil(t, err)
+}
+
+func TestDefaultHashLengths(t *testing.T) {
+	assert.Equal(t, ControlHeaderHashLengths{2, 2, 3}, DefaultHashLengths(4156, 2048))
+	assert.Equal(t, ControlHeaderHashLengths{1, 2, 4}, DefaultHashLengths(2000, 2048))
+	assert.Equal(t, ControlHeaderHashLengths{2, 2, 5}, DefaultHashLengths(150000000, 4096))
+}
+
+// testdata/sample.zsync holds the expected output of "zsyncmake -b 131072" for this data, zsyncmake picks 4 bytes
+// weak sums for it. It was computed outside of this module following the zsyncmake C sources: the rsum a and b as
+// big endian shorts and the MD4 of the zero padded block.
+func TestMake_Zsyncmake(t *testing.T) {
+	expected, err := ioutil.ReadFile("testdata/sample.zsync")
+	assert.Nil(t, err)
+
+	data := makeSampleData(100000)
+	mTime, _ := time.Parse(time.RFC1123Z, "Tue, 21 Jul 2020 17:03:30 +0000")
+	var output bytes.Buffer
+	err = Make(bytes.NewReader(data), int64(len(data)), &output,
+		MakeOptions{FileName: "sample", MTime: mTime, BlockSize: 131072})
+	assert.Nil(t, err)
+	assert.Equal(t, expected, output.Bytes())
+
+	c, err := ReadControl(bytes.NewReader(expected))
+	assert.Nil(t, err)
+	assert.Equal(t, ControlHeaderHashLengths{ConsecutiveMatchNeeded: 1, WeakCheckSumBytes: 4, StrongCheckSumBytes: 5},
+		c.HashLengths)
+
+	// the checksums are read as the sync engine computes them
+	buf := hasedbuffer.NewHashedBuffer(int(c.BlockSize))
+	_, _ = buf.ReadFull(bytes.NewReader(data))
+	assert.True(t, c.ChecksumIndex.MatchesBlock(0, buf.RollingSum(), buf.CheckSum()))
+
+	var written bytes.Buffer
+	_, err = c.WriteTo(&written)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, written.Bytes())
+}
@@ -0,0 +1,147 @@
+package control
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/AppImageCrafters/libzsync-go/chunks"
+)
+
+// WriteTo writes the control file in the zsync format, the headers are written in the order they were parsed or else
+// the one used by zsyncmake and the checksums are encoded from ChecksumIndex. Writing a parsed control file
+// reproduces it.
+func (control *Control) WriteTo(output io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	control.writeHeaders(&buf)
+
+	err := control.writeChecksums(&buf)
+	if err != nil {
+		return 0, err
+	}
+
+	return buf.WriteTo(output)
+}
+
+// writes the headers in the order they were parsed, the ones that weren't parsed are written before the first parsed
+// header that follows them in the zsyncmake order
+func (control *Control) writeHeaders(buf *bytes.Buffer) {
+	lines := control.headerLines()
+	parsed := make([]bool, len(lines))
+	var order []int
+	for _, key := range control.headerOrder {
+		for i, line := range lines {
+			if !parsed[i] && strings.EqualFold(line.key, key) {
+				parsed[i] = true
+				order = append(order, i)
+				break
+			}
+		}
+	}
+
+	next := 0
+	writeUntil := func(end int) {
+		for ; next < end; next++ {
+			if !parsed[next] {
+				buf.Write(lines[next].data)
+			}
+		}
+	}
+
+	for _, i := range order {
+		writeUntil(i)
+		buf.Write(lines[i].data)
+	}
+	writeUntil(len(lines))
+	buf.WriteString("\n")
+}
+
+// a header line, with the Z-Map2 entries that follow it
+type headerLine struct {
+	key  string
+	data []byte
+}
+
+// the header lines in the order used by zsyncmake, the extra headers go before SHA-1
+func (control *Control) headerLines() []headerLine {
+	var lines []headerLine
+	add := func(key string, value interface{}) {
+		lines = append(lines, headerLine{key: key, data: []byte(fmt.Sprintf("%s: %v\n", key, value))})
+	}
+
+	version := control.Version
+	if version == "" {
+		version = Version
+	}
+
+	add("zsync", version)
+	if control.MinVersion != "" {
+		add("Min-Version", control.MinVersion)
+	}
+	// before the extra headers, clients reading the headers in order must know that they can be ignored
+	if len(control.Safe) > 0 {
+		add("Safe", strings.Join(control.Safe, " "))
+	}
+	if control.ZFileName != "" {
+		add("Z-Filename", control.ZFileName)
+	}
+	if control.FileName != "" {
+		add("Filename", control.FileName)
+	}
+	if control.MTime != "" {
+		add("MTime", control.MTime)
+	}
+	add("Blocksize", control.BlockSize)
+	add("Length", control.FileLength)
+	add("Hash-Lengths", fmt.Sprintf("%d,%d,%d", control.HashLengths.ConsecutiveMatchNeeded,
+		control.HashLengths.WeakCheckSumBytes, control.HashLengths.StrongCheckSumBytes))
+	for _, url := range control.ZURLs {
+		add("Z-URL", url)
+	}
+	for _, url := range control.AllURLs() {
+		add("URL", url)
+	}
+	if len(control.ZMap2) > 0 {
+		// the entries follow the header line
+		add("Z-Map2", len(control.ZMap2))
+		entries := bytes.NewBuffer(lines[len(lines)-1].data)
+		_ = binary.Write(entries, binary.BigEndian, control.ZMap2)
+		lines[len(lines)-1].data = entries.Bytes()
+	}
+	if control.Recompress != "" {
+		add("Recompress", control.Recompress)
+	}
+	for _, header := range control.Extra {
+		add(header.Key, header.Value)
+	}
+	if control.SHA1 != "" {
+		add("SHA-1", control.SHA1)
+	}
+
+	return lines
+}
+
+// encodes the checksums of every block as zsyncmake does: the weak sums in the legacy layout and the strong sums
+// truncated, both to the sizes given by HashLengths
+func (control *Control) writeChecksums(buf *bytes.Buffer) error {
+	if control.ChecksumIndex == nil {
+		return nil
+	}
+
+	weakLen := int(control.HashLengths.WeakCheckSumBytes)
+	strongLen := int(control.HashLengths.StrongCheckSumBytes)
+	for i := 0; i < control.ChecksumIndex.BlockCount; i++ {
+		block, _ := control.ChecksumIndex.Block(uint(i))
+		if len(block.WeakChecksum) != 4 || len(block.StrongChecksum) < strongLen || weakLen < 1 || weakLen > 4 {
+			return fmt.Errorf("unable to encode the checksums of block %d with Hash-Lengths %d,%d", i, weakLen,
+				strongLen)
+		}
+
+		buf.Write(chunks.TransformToLegacyRepresentation(block.WeakChecksum, weakLen))
+		buf.Write(block.StrongChecksum[:strongLen])
+	}
+
+	return nil
+}
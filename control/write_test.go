@@ -0,0 +1,136 @@
+package control
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControl_WriteToRoundTrip(t *testing.T) {
+	mTime, _ := time.Parse(time.RFC1123Z, "Tue, 21 Jul 2020 17:03:30 +0000")
+	tests := []struct {
+		name    string
+		size    int
+		options MakeOptions
+	}{
+		{"defaults", 4156, MakeOptions{FileName: "file", MTime: mTime}},
+		{"full checksums", 2048*5 + 100, MakeOptions{URL: "http://localhost/file",
+			HashLengths: ControlHeaderHashLengths{ConsecutiveMatchNeeded: 1, WeakCheckSumBytes: 4, StrongCheckSumBytes: 16}}},
+		{"one byte weak checksums", 2048 * 3, MakeOptions{FileName: "file",
+			HashLengths: ControlHeaderHashLengths{ConsecutiveMatchNeeded: 2, WeakCheckSumBytes: 1, StrongCheckSumBytes: 5}}},
+		{"empty file", 0, MakeOptions{FileName: "empty"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := makeSampleData(tt.size)
+			var original bytes.Buffer
+			err := Make(bytes.NewReader(data), int64(len(data)), &original, tt.options)
+			assert.Nil(t, err)
+
+			c, err := ReadControl(bytes.NewReader(original.Bytes()))
+			assert.Nil(t, err)
+
+			var written bytes.Buffer
+			n, err := c.WriteTo(&written)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(original.Len()), n)
+			assert.Equal(t, original.Bytes(), written.Bytes())
+		})
+	}
+}
+
+func TestControl_WriteToMirrors(t *testing.T) {
+	data := makeSampleData(4156)
+	var original bytes.Buffer
+	err := Make(bytes.NewReader(data), int64(len(data)), &original, MakeOptions{FileName: "file"})
+	assert.Nil(t, err)
+
+	c, err := ReadControl(&original)
+	assert.Nil(t, err)
+
+	c.URLs = []string{"http://mirror1.example.com/file", "http://mirror2.example.com/file"}
+	c.URL = c.URLs[0]
+
+	var written bytes.Buffer
+	_, err = c.WriteTo(&written)
+	assert.Nil(t, err)
+	assert.Contains(t, written.String(),
+		"URL: http://mirror1.example.com/file\nURL: http://mirror2.example.com/file\nSHA-1:")
+
+	rewritten, err := ReadControl(&written)
+	assert.Nil(t, err)
+	assert.Equal(t, c.URLs, rewritten.URLs)
+	assert.Equal(t, c.SHA1, rewritten.SHA1)
+	assert.Equal(t, c.Blocks, rewritten.Blocks)
+	for i := uint(0); i < c.Blocks; i++ {
+		expected, _ := c.ChecksumIndex.Block(i)
+		actual, _ := rewritten.ChecksumIndex.Block(i)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestControl_WriteToURL(t *testing.T) {
+	c, err := ReadControl(bytes.NewReader([]byte("zsync: 0.6.2\nBlocksize: 2048\nLength: 0\n" +
+		"Hash-Lengths: 1,4,16\nURL: f\nURL: http://mirror2.example.com/f\n\n")))
+	assert.Nil(t, err)
+
+	c.URL = "http://mirror1.example.com/f"
+
+	var written bytes.Buffer
+	_, err = c.WriteTo(&written)
+	assert.Nil(t, err)
+
+	rewritten, err := ReadControl(&written)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://mirror1.example.com/f", rewritten.URL)
+	assert.Equal(t, []string{"http://mirror1.example.com/f", "http://mirror2.example.com/f"}, rewritten.URLs)
+}
+
+func TestControl_WriteToExtensionHeaders(t *testing.T) {
+	c, err := ReadControl(bytes.NewReader(extensionHeadersControl))
+	assert.Nil(t, err)
+
+	var written bytes.Buffer
+	_, err = c.WriteTo(&written)
+	assert.Nil(t, err)
+	assert.Equal(t, extensionHeadersControl, written.Bytes())
+}
+
+func TestControl_WriteToModifiedHeaders(t *testing.T) {
+	c, err := ReadControl(bytes.NewReader(extensionHeadersControl))
+	assert.Nil(t, err)
+
+	// the new headers go before the first parsed header that follows them in the zsyncmake order
+	c.MinVersion = "0.6.0"
+	c.Recompress = ""
+	c.Extra = append(c.Extra, Header{Key: "X-New", Value: "new"})
+
+	var written bytes.Buffer
+	_, err = c.WriteTo(&written)
+	assert.Nil(t, err)
+
+	expected := bytes.Replace(extensionHeadersControl, []byte("zsync: 0.6.2\n"),
+		[]byte("zsync: 0.6.2\nMin-Version: 0.6.0\n"), 1)
+	expected = bytes.Replace(expected, []byte("Recompress: gzip -n --best\n"), nil, 1)
+	expected = bytes.Replace(expected, []byte("SHA-1:"), []byte("X-New: new\nSHA-1:"), 1)
+	assert.Equal(t, string(expected), written.String())
+}
+
+func TestControl_WriteToZsyncmakeOrder(t *testing.T) {
+	c := &Control{Version: "0.6.2", MinVersion: "0.6.0", FileName: "file", ZFileName: "file.gz", BlockSize: 2048,
+		HashLengths: ControlHeaderHashLengths{ConsecutiveMatchNeeded: 1, WeakCheckSumBytes: 4, StrongCheckSumBytes: 16},
+		URL:         "file", ZURLs: []string{"file.gz"}, SHA1: "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+		ZMap2: []ZMapEntry{{InBitOffset: 1, OutByteOffset: 2}}, Recompress: "gzip -n --best",
+		Safe: []string{"Z-Filename", "Recompress", "X-Custom"}, Extra: Headers{{Key: "X-Custom", Value: "value"}}}
+
+	var written bytes.Buffer
+	_, err := c.WriteTo(&written)
+	assert.Nil(t, err)
+	assert.Equal(t, "zsync: 0.6.2\nMin-Version: 0.6.0\nSafe: Z-Filename Recompress X-Custom\nZ-Filename: file.gz\n"+
+		"Filename: file\nBlocksize: 2048\nLength: 0\nHash-Lengths: 1,4,16\nZ-URL: file.gz\nURL: file\n"+
+		"Z-Map2: 1\n\x00\x01\x00\x02Recompress: gzip -n --best\nX-Custom: value\n"+
+		"SHA-1: da39a3ee5e6b4b0d3255bfef95601890afd80709\n\n", written.String())
+}
@@ -0,0 +1,69 @@
+package zsync
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+
+	"github.com/AppImageCrafters/libzsync-go/chunks"
+	"github.com/AppImageCrafters/libzsync-go/sources"
+)
+
+// DownloadStrategy defines how the missing ranges are fetched from the remote file
+type DownloadStrategy int
+
+const (
+	// RangeRequests downloads only the missing ranges using HTTP range requests
+	RangeRequests DownloadStrategy = iota
+	// StreamMissingRanges streams the whole remote file once and picks the missing ranges as they pass by
+	StreamMissingRanges
+	// DownloadWholeFile streams the whole remote file into the output, the seed isn't used
+	DownloadWholeFile
+)
+
+func (s DownloadStrategy) String() string {
+	switch s {
+	case RangeRequests:
+		return "range requests"
+	case StreamMissingRanges:
+		return "stream missing ranges"
+	case DownloadWholeFile:
+		return "download whole file"
+	default:
+		return fmt.Sprintf("DownloadStrategy(%d)", int(s))
+	}
+}
+
+// rewrites the output from the beginning streaming the remote file instead of using range requests
+func (zsync *ZSync) writeStreamed(ctx context.Context, output io.WriteSeeker, mappedChunks []chunks.ChunkInfo,
+	missingRanges []sources.ByteRange, validator *sources.RemoteValidator, stats *sources.TransferStats) (string,
+	error) {
+	if zsync.RangesFallback == DownloadWholeFile {
+		mappedChunks = nil
+		missingRanges = []sources.ByteRange{{Begin: 0, End: zsync.RemoteFileSize}}
+	}
+
+	_, err := output.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", fmt.Errorf("unable to seek output start: %s", err.Error())
+	}
+
+	hashedOutput := &hashedWriteSeeker{output: output, hash: sha1.New()}
+	source := zsync.newRemoteSource(ctx, 0, nil, validator, stats)
+
+	writer := &sequentialWriter{output: hashedOutput, mappedChunks: mappedChunks}
+	if len(missingRanges) > 0 {
+		err = source.StreamRanges(missingRanges, writer.writeRange)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = writer.finish(zsync.RemoteFileSize)
+	if err != nil {
+		return "", err
+	}
+
+	return hashedOutput.SumHex(), nil
+}
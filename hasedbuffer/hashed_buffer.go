@@ -137,14 +137,15 @@ func (h *HashedRingBuffer) ReadFull(input io.Reader) (int64, error) {
 	newCharIdx := h.rBuf.Beg + h.rBuf.Readable
 	n, err := h.rBuf.ReadFrom(input)
 
-	missingChars := uint16(h.rBuf.N) - uint16(n)
+	missingChars := int64(h.rBuf.N) - n
 	_, _ = h.rBuf.ReadFrom(bytes.NewBuffer(make([]byte, missingChars)))
 
-	for i := uint16(h.rBuf.N); i > 0; i-- {
+	// the sums are modulo 2^16, truncating the distance to the end of the block doesn't change them
+	for i := h.rBuf.N; i > 0; i-- {
 		newChar := uint16(h.rBuf.A[h.rBuf.Use][newCharIdx])
 		newCharIdx = h.rBuf.Nextpos(newCharIdx)
 
-		h.hash.Append(newChar, i)
+		h.hash.Append(newChar, uint16(i))
 	}
 
 	return n, err
@@ -141,3 +141,22 @@ func TestHashedRingBuffer_ReadByte(t *testing.T) {
 	assert.Equal(t, []byte{2}, buf.Bytes())
 	assert.Equal(t, []byte{2, 0, 4, 0}, buf.RollingSum())
 }
+
+func TestHashedRingBuffer_ReadFullLargeBlock(t *testing.T) {
+	data := make([]byte, 1<<17)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	// the sums don't depend on how the block is read
+	readBuf := NewHashedBuffer(len(data))
+	n, err := readBuf.ReadFull(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(data)), n)
+
+	writeBuf := NewHashedBuffer(len(data))
+	_, _ = writeBuf.Write(data)
+
+	assert.Equal(t, writeBuf.RollingSum(), readBuf.RollingSum())
+	assert.NotEqual(t, []byte{0, 0, 0, 0}, readBuf.RollingSum())
+}
@@ -48,6 +48,12 @@ type ChecksumIndex struct {
 
 	WeakChecksumSize   uint
 	StrongChecksumSize uint
+
+	// number of consecutive blocks that must match before accepting a match, see zsync Hash-Lengths
+	ConsecutiveMatchNeeded uint
+
+	// checksums sorted by chunk offset, used to verify consecutive matches
+	blocks []chunks.ChunkChecksum
 }
 
 // Builds an index in which chunks can be found, with their corresponding offsets
@@ -58,9 +64,14 @@ func MakeChecksumIndex(checksums []chunks.ChunkChecksum, weakChecksumSize uint,
 		weakChecksumLookup: make([]map[uint32]StrongChecksumList, 256),
 		WeakChecksumSize:   weakChecksumSize,
 		StrongChecksumSize: strongChecksumSize,
+		blocks:             make([]chunks.ChunkChecksum, len(checksums)),
 	}
 
 	for _, chunk := range checksums {
+		if chunk.ChunkOffset < uint(len(n.blocks)) {
+			n.blocks[chunk.ChunkOffset] = chunk
+		}
+
 		var weakChecksumAsInt uint32
 
 		if len(chunk.WeakChecksum) == 4 {
@@ -116,16 +127,41 @@ func (index *ChecksumIndex) FindWeakChecksumInIndex(weak []byte) StrongChecksumL
 	return nil
 }
 
-// support smaller weak checksums
+// support smaller weak checksums, clears the bytes not stored in the legacy representation
+// see chunks.TransformToInternalRepresentation
 func (index *ChecksumIndex) TruncWeakChecksum(weak []byte) {
 	weakLen := uint(len(weak))
 	if weakLen > index.WeakChecksumSize {
 		for i := uint(0); i < (weakLen - index.WeakChecksumSize); i++ {
-			weak[i] = 0
+			weak[i^1] = 0
 		}
 	}
 }
 
+// Block returns the checksums of the block at chunkOffset
+func (index *ChecksumIndex) Block(chunkOffset uint) (chunks.ChunkChecksum, bool) {
+	if chunkOffset >= uint(len(index.blocks)) {
+		return chunks.ChunkChecksum{}, false
+	}
+
+	return index.blocks[chunkOffset], true
+}
+
+// Checks if the given checksums match the ones of the block at chunkOffset
+func (index *ChecksumIndex) MatchesBlock(chunkOffset uint, weak []byte, strong []byte) bool {
+	if chunkOffset >= uint(len(index.blocks)) {
+		return false
+	}
+
+	block := index.blocks[chunkOffset]
+	index.TruncWeakChecksum(weak)
+	if !bytes.Equal(block.WeakChecksum, weak) {
+		return false
+	}
+
+	return StrongChecksumList(nil).CompareStrongChecksums(block.StrongChecksum, strong) == 0
+}
+
 func (index *ChecksumIndex) FindWeakChecksum2(chk []byte) interface{} {
 	w := index.FindWeakChecksumInIndex(chk)
 
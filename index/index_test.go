@@ -204,3 +204,24 @@ func TestFindTwoDuplicatedBlocksInIndex(t *testing.T) {
 		t.Errorf("Wrong chunk found, had offset %v", second.ChunkOffset)
 	}
 }
+
+func TestMatchesBlock(t *testing.T) {
+	i := MakeChecksumIndex(
+		[]chunks.ChunkChecksum{
+			{ChunkOffset: 0, WeakChecksum: WEAK_A, StrongChecksum: []byte("b")},
+			{ChunkOffset: 1, WeakChecksum: WEAK_B, StrongChecksum: []byte("c")},
+		}, 4, 16,
+	)
+
+	if !i.MatchesBlock(1, []byte("bbbb"), []byte("c")) {
+		t.Error("Block 1 should match")
+	}
+
+	if i.MatchesBlock(0, []byte("bbbb"), []byte("c")) {
+		t.Error("Block 0 should not match")
+	}
+
+	if i.MatchesBlock(2, []byte("bbbb"), []byte("c")) {
+		t.Error("Out of range block should not match")
+	}
+}
@@ -0,0 +1,165 @@
+package zsync
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/AppImageCrafters/libzsync-go/chunks"
+	"github.com/AppImageCrafters/libzsync-go/sources"
+)
+
+type writerReaderAt interface {
+	io.WriterAt
+	io.ReaderAt
+}
+
+// writes the output using DownloadConcurrency workers to fetch the missing ranges, the checksum is computed by
+// reading back the output
+func (zsync *ZSync) writeParallel(ctx context.Context, output writerReaderAt,
+	mappedChunks []chunks.ChunkInfo, batches [][]sources.ByteRange, limiter *sources.ConnectionLimiter,
+	validator *sources.RemoteValidator, stats *sources.TransferStats) (string, error) {
+	downloadCtx, cancelDownload := context.WithCancel(ctx)
+	defer cancelDownload()
+
+	batchesChan := make(chan []sources.ByteRange)
+	errorsChan := make(chan error, zsync.DownloadConcurrency)
+	var waitGroup sync.WaitGroup
+
+	for i := 0; i < zsync.DownloadConcurrency; i++ {
+		waitGroup.Add(1)
+		go func(workerId int) {
+			defer waitGroup.Done()
+
+			err := zsync.downloadBatches(downloadCtx, workerId, output, batchesChan, limiter, validator, stats)
+			if err != nil {
+				errorsChan <- err
+				// fail fast
+				cancelDownload()
+			}
+		}(i)
+	}
+
+	go func() {
+		defer close(batchesChan)
+		for _, batch := range batches {
+			select {
+			case batchesChan <- batch:
+			case <-downloadCtx.Done():
+				return
+			}
+		}
+	}()
+
+	// the downloaded ranges take precedence over the mapped chunks they cover
+	mappedErr := writeChunksAt(output, excludeChunksInRanges(mappedChunks, batches))
+	if mappedErr != nil {
+		cancelDownload()
+	}
+
+	waitGroup.Wait()
+	close(errorsChan)
+
+	if mappedErr != nil {
+		return "", mappedErr
+	}
+
+	// the first worker error is the cause of any other
+	if err := <-errorsChan; err != nil {
+		return "", err
+	}
+
+	outputHash := sha1.New()
+	_, err := io.Copy(outputHash, io.NewSectionReader(output, 0, zsync.RemoteFileSize))
+	if err != nil {
+		return "", fmt.Errorf("unable to read output: %s", err.Error())
+	}
+
+	return hex.EncodeToString(outputHash.Sum(nil)), nil
+}
+
+func (zsync *ZSync) downloadBatches(ctx context.Context, workerId int, output io.WriterAt,
+	batchesChan <-chan []sources.ByteRange, limiter *sources.ConnectionLimiter,
+	validator *sources.RemoteValidator, stats *sources.TransferStats) error {
+	// spread the workers across the mirrors
+	source := zsync.newRemoteSource(ctx, workerId, limiter, validator, stats)
+
+	for batch := range batchesChan {
+		err := source.ReadRanges(batch, func(byteRange sources.ByteRange, body io.Reader) error {
+			return writeRangeAt(output, byteRange, body)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+func writeRangeAt(output io.WriterAt, byteRange sources.ByteRange, body io.Reader) error {
+	n, err := io.CopyN(&offsetWriter{output: output, offset: byteRange.Begin}, body, byteRange.Size())
+	if err != nil {
+		return fmt.Errorf("unable to copy bytes: %d %s", n, err.Error())
+	}
+
+	return nil
+}
+
+// copies the chunks from their sources, which must implement io.ReaderAt
+func writeChunksAt(output io.WriterAt, chunkList []chunks.ChunkInfo) error {
+	for _, chunk := range chunkList {
+		input, ok := chunk.Source.(io.ReaderAt)
+		if !ok {
+			return fmt.Errorf("unable to read chunk at offset %d: source doesn't implement io.ReaderAt",
+				chunk.TargetOffset)
+		}
+
+		n, err := io.CopyN(&offsetWriter{output: output, offset: chunk.TargetOffset},
+			io.NewSectionReader(input, chunk.SourceOffset, chunk.Size), chunk.Size)
+		if err != nil {
+			return fmt.Errorf("unable to copy bytes: %d %s", n, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// removes the chunks that overlap any of the ranges, both lists must be sorted
+func excludeChunksInRanges(chunkList []chunks.ChunkInfo, batches [][]sources.ByteRange) []chunks.ChunkInfo {
+	var ranges []sources.ByteRange
+	for _, batch := range batches {
+		ranges = append(ranges, batch...)
+	}
+
+	var result []chunks.ChunkInfo
+	for _, chunk := range chunkList {
+		for len(ranges) > 0 && ranges[0].End <= chunk.TargetOffset {
+			ranges = ranges[1:]
+		}
+
+		if len(ranges) > 0 && ranges[0].Begin < chunk.TargetOffset+chunk.Size {
+			continue
+		}
+
+		result = append(result, chunk)
+	}
+
+	return result
+}
+
+// sequential io.Writer over an io.WriterAt
+type offsetWriter struct {
+	output io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = w.output.WriteAt(p, w.offset)
+	w.offset += int64(n)
+
+	return n, err
+}
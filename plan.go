@@ -0,0 +1,305 @@
+package zsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/AppImageCrafters/libzsync-go/chunks"
+	"github.com/AppImageCrafters/libzsync-go/chunksmapper"
+	"github.com/AppImageCrafters/libzsync-go/sources"
+)
+
+// SyncPlan lists the operations that write the remote file: the chunks copied from the seeds and the ranges
+// downloaded from the remote file. Together they cover the remote file, a download coalesced according to MaxRangeGap
+// can also cover copied chunks, it writes the same bytes.
+type SyncPlan struct {
+	// the remote file written by the plan
+	FileLength int64
+	BlockSize  int64
+	SHA1       string
+
+	// the seeds the chunks are copied from, they must be readable until the plan is executed. See OpenSeeds
+	Seeds []Seed
+	// sorted by TargetOffset
+	Copies []ChunkCopy
+	// ranges of the remote file, sorted and coalesced according to MaxRangeGap. They don't overlap each other
+	Downloads []sources.ByteRange
+	// the expected totals, the transfer statistics are filled by Execute
+	Totals SyncTotals
+
+	// expected checksums of the remote file blocks, indexed by block
+	blocks     []chunks.ChunkChecksum
+	closeSeeds func()
+}
+
+// ChunkCopy copies Size bytes of Seeds[Seed] at SourceOffset to TargetOffset in the output
+type ChunkCopy struct {
+	Seed         int
+	SourceOffset int64
+	TargetOffset int64
+	Size         int64
+}
+
+// Close releases the seeds opened by Plan and PlanSeedsContext
+func (p *SyncPlan) Close() {
+	if p.closeSeeds != nil {
+		p.closeSeeds()
+		p.closeSeeds = nil
+	}
+}
+
+// Plan scans the seed at seedPath and returns the operations needed to write the remote file, the network and the
+// output are not used. The seed stays open until the plan is closed.
+func (zsync *ZSync) Plan(seedPath string) (*SyncPlan, error) {
+	return zsync.PlanSeedsContext(context.Background(), []string{seedPath})
+}
+
+// PlanSeedsContext is like Plan but the chunks are searched in several seeds. It stops scanning the seeds once ctx is
+// done, ctx.Err() is returned in such case.
+func (zsync *ZSync) PlanSeedsContext(ctx context.Context, seedPaths []string) (*SyncPlan, error) {
+	seeds, closeSeeds, err := openSeeds(seedPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := zsync.PlanReadersContext(ctx, seeds)
+	if err != nil {
+		closeSeeds()
+		return nil, err
+	}
+
+	plan.closeSeeds = closeSeeds
+	return plan, nil
+}
+
+// PlanReadersContext is like PlanSeedsContext but the seeds can be any io.ReaderAt, closing the plan doesn't close
+// them
+func (zsync *ZSync) PlanReadersContext(ctx context.Context, seeds []Seed) (*SyncPlan, error) {
+	return zsync.plan(ctx, nil, seeds)
+}
+
+// Scans the seeds, if partial is not nil its blocks that are already in place are used first. partial becomes the
+// first seed of the plan.
+func (zsync *ZSync) plan(ctx context.Context, partial *Seed, seeds []Seed) (*SyncPlan, error) {
+	plan := &SyncPlan{
+		FileLength: zsync.RemoteFileSize,
+		BlockSize:  zsync.BlockSize,
+		SHA1:       zsync.SHA1,
+		blocks:     make([]chunks.ChunkChecksum, zsync.ChecksumsIndex.BlockCount),
+	}
+	for i := range plan.blocks {
+		plan.blocks[i], _ = zsync.ChecksumsIndex.Block(uint(i))
+	}
+
+	chunkMapper := chunksmapper.NewFileChunksMapper(zsync.RemoteFileSize)
+	// identifies the seed of each chunk
+	seedIndexes := map[io.ReadSeeker]int{}
+
+	scanStart := time.Now()
+	if partial != nil {
+		source := io.NewSectionReader(partial.Reader, 0, partial.Size)
+		seedIndexes[source] = len(plan.Seeds)
+		plan.Seeds = append(plan.Seeds, *partial)
+
+		err := zsync.mapPartialChunks(ctx, source, chunkMapper)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, seed := range seeds {
+		source := io.NewSectionReader(seed.Reader, 0, seed.Size)
+		seedIndexes[source] = len(plan.Seeds)
+		plan.Seeds = append(plan.Seeds, seed)
+
+		err := zsync.mapSeedChunks(ctx, seed, source, chunkMapper)
+		if err != nil {
+			return nil, err
+		}
+
+		plan.Totals.SeedBytesScanned += seed.Size
+	}
+
+	mappedChunks := chunkMapper.GetMappedChunks()
+	for _, chunk := range mappedChunks {
+		plan.Copies = append(plan.Copies, ChunkCopy{
+			Seed:         seedIndexes[chunk.Source],
+			SourceOffset: chunk.SourceOffset,
+			TargetOffset: chunk.TargetOffset,
+			Size:         chunk.Size,
+		})
+	}
+
+	plan.Downloads = sources.CoalesceRanges(chunksToRanges(chunkMapper.GetMissingChunks()), zsync.MaxRangeGap)
+	plan.Totals.ScanDuration = time.Since(scanStart)
+
+	downloadSize := sumRangeSizes(plan.Downloads)
+	plan.Totals.MatchedChunks = len(mappedChunks)
+	plan.Totals.MatchedBytes = sumChunkSizes(mappedChunks)
+	plan.Totals.ReusedBytes = zsync.RemoteFileSize - downloadSize
+	plan.Totals.DownloadedBytes = downloadSize
+	zsync.notifySyncPlanned(plan.Totals.ReusedBytes, plan.Totals.DownloadedBytes)
+
+	return plan, nil
+}
+
+// Execute writes the remote file into output following plan, see Sync
+func (zsync *ZSync) Execute(plan *SyncPlan, output io.WriteSeeker) (SyncTotals, error) {
+	return zsync.ExecuteContext(context.Background(), plan, output)
+}
+
+// ExecuteContext is like Execute but it stops downloading chunks once ctx is done, ctx.Err() is returned in such case
+func (zsync *ZSync) ExecuteContext(ctx context.Context, plan *SyncPlan, output io.WriteSeeker) (SyncTotals, error) {
+	if plan.FileLength != zsync.RemoteFileSize || plan.BlockSize != zsync.BlockSize {
+		return SyncTotals{}, fmt.Errorf("the plan writes a file of %d bytes in blocks of %d bytes, expected %d and %d",
+			plan.FileLength, plan.BlockSize, zsync.RemoteFileSize, zsync.BlockSize)
+	}
+
+	mappedChunks, err := plan.chunks()
+	if err != nil {
+		return SyncTotals{}, err
+	}
+
+	totals := plan.Totals
+	stats := &sources.TransferStats{}
+	// bytes of the remote file that have to be downloaded
+	missingBytes := zsync.RemoteFileSize - totals.MatchedBytes
+
+	batches := batchRanges(plan.Downloads, zsync.getMaxRangesPerRequest())
+	limiter := sources.NewConnectionLimiter(zsync.MaxConnectionsPerHost)
+	// shared by all the sources so every range comes from the same version of the remote file
+	validator := sources.NewRemoteValidator()
+
+	downloadStart := time.Now()
+	var checksum string
+	if parallelOutput, ok := output.(writerReaderAt); ok && zsync.DownloadConcurrency > 1 {
+		checksum, err = zsync.writeParallel(ctx, parallelOutput, mappedChunks, batches, limiter, validator, stats)
+	} else {
+		checksum, err = zsync.writeSequential(ctx, output, mappedChunks, batches, limiter, validator, stats)
+	}
+
+	if errors.Is(err, sources.ErrRangeNotSupported) && zsync.RangesFallback != RangeRequests && ctx.Err() == nil {
+		totals.Strategy = zsync.RangesFallback
+		if totals.Strategy == DownloadWholeFile {
+			missingBytes = zsync.RemoteFileSize
+			totals.ReusedBytes = 0
+			totals.DownloadedBytes = zsync.RemoteFileSize
+		}
+
+		checksum, err = zsync.writeStreamed(ctx, output, mappedChunks, plan.Downloads, validator, stats)
+	}
+	totals.DownloadDuration = time.Since(downloadStart)
+
+	totals.setTransferStats(stats, missingBytes)
+	if err != nil {
+		return totals, contextErrOr(ctx, err)
+	}
+
+	verifyStart := time.Now()
+	err = zsync.verifyChecksum(output, checksum)
+	totals.VerifyDuration = time.Since(verifyStart)
+	if err != nil {
+		return totals, err
+	}
+
+	zsync.notifySyncFinished(totals)
+	return totals, nil
+}
+
+// converts the copies to chunks read from the seeds
+func (p *SyncPlan) chunks() ([]chunks.ChunkInfo, error) {
+	seedSources := make([]io.ReadSeeker, len(p.Seeds))
+	for i, seed := range p.Seeds {
+		if seed.Reader == nil {
+			return nil, fmt.Errorf("seed %s is not open", seed.Name)
+		}
+
+		seedSources[i] = io.NewSectionReader(seed.Reader, 0, seed.Size)
+	}
+
+	chunkList := make([]chunks.ChunkInfo, len(p.Copies))
+	for i, chunkCopy := range p.Copies {
+		if chunkCopy.Seed < 0 || chunkCopy.Seed >= len(p.Seeds) {
+			return nil, fmt.Errorf("invalid plan: chunk at %d copied from unknown seed %d", chunkCopy.TargetOffset,
+				chunkCopy.Seed)
+		}
+
+		chunkList[i] = chunks.ChunkInfo{
+			Size:         chunkCopy.Size,
+			Source:       seedSources[chunkCopy.Seed],
+			SourceOffset: chunkCopy.SourceOffset,
+			TargetOffset: chunkCopy.TargetOffset,
+		}
+	}
+
+	return chunkList, nil
+}
+
+// OpenSeeds opens the seeds without a Reader, like the ones of a decoded plan, as files named after them. Their size
+// must match the planned one.
+func (p *SyncPlan) OpenSeeds() error {
+	for i, seed := range p.Seeds {
+		if seed.Reader != nil {
+			continue
+		}
+
+		opened, err := OpenSeed(seed.Name)
+		if err != nil {
+			return err
+		}
+
+		previousClose := p.closeSeeds
+		p.closeSeeds = func() {
+			_ = opened.Close()
+			if previousClose != nil {
+				previousClose()
+			}
+		}
+
+		if opened.Size != seed.Size {
+			return fmt.Errorf("seed %s changed: %d bytes, %d expected", seed.Name, opened.Size, seed.Size)
+		}
+
+		p.Seeds[i] = opened
+	}
+
+	return nil
+}
+
+// CheckPlan verifies that plan writes the remote file: the blocks checksums must match the control file and the
+// seed data copied must match them
+func (zsync *ZSync) CheckPlan(plan *SyncPlan) error {
+	if plan.FileLength != zsync.RemoteFileSize || plan.BlockSize != zsync.BlockSize || plan.SHA1 != zsync.SHA1 {
+		return fmt.Errorf("the plan was made for another file")
+	}
+
+	for i, block := range plan.blocks {
+		if !zsync.ChecksumsIndex.MatchesBlock(uint(i), copyBytes(block.WeakChecksum), block.StrongChecksum) {
+			return fmt.Errorf("the checksums of block %d don't match the control file", i)
+		}
+	}
+
+	for _, chunkCopy := range plan.Copies {
+		if chunkCopy.Seed < 0 || chunkCopy.Seed >= len(plan.Seeds) || plan.Seeds[chunkCopy.Seed].Reader == nil {
+			return fmt.Errorf("the seed of the chunk at %d is not available", chunkCopy.TargetOffset)
+		}
+
+		// the missing bytes of the last block are replaced by '0' as in the control file
+		seed := plan.Seeds[chunkCopy.Seed]
+		weakSum, strongSum := zsync.readBlockChecksums(
+			io.NewSectionReader(seed.Reader, chunkCopy.SourceOffset, chunkCopy.Size), 0)
+		if !zsync.ChecksumsIndex.MatchesBlock(uint(chunkCopy.TargetOffset/zsync.BlockSize), weakSum, strongSum) {
+			return fmt.Errorf("%s at offset %d doesn't match the block at %d", seed.Name, chunkCopy.SourceOffset,
+				chunkCopy.TargetOffset)
+		}
+	}
+
+	return nil
+}
+
+func copyBytes(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,532 @@
+package zsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/AppImageCrafters/libzsync-go/chunks"
+	"github.com/AppImageCrafters/libzsync-go/sources"
+)
+
+// version of the plan encodings, increased on incompatible changes
+const planEncodingVersion = 1
+
+// prefix of the binary encoding
+const planMagic = "ZSPLAN"
+
+// The plan encodings hold the seeds names and sizes, the decoded seeds must be opened before executing the plan, see
+// SyncPlan.OpenSeeds. Every copy and download carries the checksums of the blocks it writes, see ZSync.CheckPlan.
+type planJSON struct {
+	Version   int             `json:"version"`
+	File      planFileJSON    `json:"file"`
+	Seeds     []planSeedJSON  `json:"seeds"`
+	Copies    []planCopyJSON  `json:"copies"`
+	Downloads []planRangeJSON `json:"downloads"`
+	Totals    planTotalsJSON  `json:"totals"`
+}
+
+type planFileJSON struct {
+	Length    int64  `json:"length"`
+	BlockSize int64  `json:"blockSize"`
+	SHA1      string `json:"sha1,omitempty"`
+}
+
+type planSeedJSON struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+type blockChecksumJSON struct {
+	Block  int64  `json:"block"`
+	Weak   string `json:"weak"`
+	Strong string `json:"strong"`
+}
+
+type planCopyJSON struct {
+	Seed         int               `json:"seed"`
+	SourceOffset int64             `json:"sourceOffset"`
+	TargetOffset int64             `json:"targetOffset"`
+	Size         int64             `json:"size"`
+	Checksum     blockChecksumJSON `json:"checksum"`
+}
+
+type planRangeJSON struct {
+	Begin     int64               `json:"begin"`
+	End       int64               `json:"end"`
+	Checksums []blockChecksumJSON `json:"checksums"`
+}
+
+type planTotalsJSON struct {
+	SeedBytesScanned int64 `json:"seedBytesScanned"`
+	MatchedChunks    int   `json:"matchedChunks"`
+	MatchedBytes     int64 `json:"matchedBytes"`
+	ReusedBytes      int64 `json:"reusedBytes"`
+	DownloadedBytes  int64 `json:"downloadedBytes"`
+}
+
+// MarshalJSON encodes the plan, the seeds are identified by their name
+func (p *SyncPlan) MarshalJSON() ([]byte, error) {
+	encoded := planJSON{
+		Version: planEncodingVersion,
+		File:    planFileJSON{Length: p.FileLength, BlockSize: p.BlockSize, SHA1: p.SHA1},
+		// empty lists are encoded as [] rather than null
+		Seeds:     []planSeedJSON{},
+		Copies:    []planCopyJSON{},
+		Downloads: []planRangeJSON{},
+		Totals: planTotalsJSON{
+			SeedBytesScanned: p.Totals.SeedBytesScanned,
+			MatchedChunks:    p.Totals.MatchedChunks,
+			MatchedBytes:     p.Totals.MatchedBytes,
+			ReusedBytes:      p.Totals.ReusedBytes,
+			DownloadedBytes:  p.Totals.DownloadedBytes,
+		},
+	}
+
+	for _, seed := range p.Seeds {
+		encoded.Seeds = append(encoded.Seeds, planSeedJSON{Name: seed.Name, Size: seed.Size})
+	}
+
+	for _, chunkCopy := range p.Copies {
+		encoded.Copies = append(encoded.Copies, planCopyJSON{
+			Seed:         chunkCopy.Seed,
+			SourceOffset: chunkCopy.SourceOffset,
+			TargetOffset: chunkCopy.TargetOffset,
+			Size:         chunkCopy.Size,
+			Checksum:     p.blockChecksumJSON(p.blockAt(chunkCopy.TargetOffset)),
+		})
+	}
+
+	for _, byteRange := range p.Downloads {
+		encodedRange := planRangeJSON{Begin: byteRange.Begin, End: byteRange.End}
+		for block := p.blockAt(byteRange.Begin); block <= p.blockAt(byteRange.End-1); block++ {
+			encodedRange.Checksums = append(encodedRange.Checksums, p.blockChecksumJSON(block))
+		}
+
+		encoded.Downloads = append(encoded.Downloads, encodedRange)
+	}
+
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes a plan encoded by MarshalJSON
+func (p *SyncPlan) UnmarshalJSON(data []byte) error {
+	var encoded planJSON
+	err := json.Unmarshal(data, &encoded)
+	if err != nil {
+		return err
+	}
+
+	if encoded.Version != planEncodingVersion {
+		return fmt.Errorf("unsupported plan version %d", encoded.Version)
+	}
+
+	decoded, err := newDecodedPlan(encoded.File.Length, encoded.File.BlockSize, encoded.File.SHA1)
+	if err != nil {
+		return err
+	}
+
+	for _, seed := range encoded.Seeds {
+		decoded.Seeds = append(decoded.Seeds, Seed{Name: seed.Name, Size: seed.Size})
+	}
+
+	for _, chunkCopy := range encoded.Copies {
+		decoded.Copies = append(decoded.Copies, ChunkCopy{
+			Seed:         chunkCopy.Seed,
+			SourceOffset: chunkCopy.SourceOffset,
+			TargetOffset: chunkCopy.TargetOffset,
+			Size:         chunkCopy.Size,
+		})
+
+		err = decoded.setBlockChecksumJSON(decoded.blockAt(chunkCopy.TargetOffset), chunkCopy.Checksum)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, byteRange := range encoded.Downloads {
+		decoded.Downloads = append(decoded.Downloads, sources.ByteRange{Begin: byteRange.Begin, End: byteRange.End})
+		if byteRange.End <= byteRange.Begin {
+			return fmt.Errorf("invalid plan: empty download range at %d", byteRange.Begin)
+		}
+
+		first := decoded.blockAt(byteRange.Begin)
+		if int64(len(byteRange.Checksums)) != decoded.blockAt(byteRange.End-1)-first+1 {
+			return fmt.Errorf("invalid plan: wrong number of checksums for the range at %d", byteRange.Begin)
+		}
+
+		for i, checksum := range byteRange.Checksums {
+			err = decoded.setBlockChecksumJSON(first+int64(i), checksum)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	decoded.Totals = SyncTotals{
+		SeedBytesScanned: encoded.Totals.SeedBytesScanned,
+		MatchedChunks:    encoded.Totals.MatchedChunks,
+		MatchedBytes:     encoded.Totals.MatchedBytes,
+		ReusedBytes:      encoded.Totals.ReusedBytes,
+		DownloadedBytes:  encoded.Totals.DownloadedBytes,
+	}
+
+	err = decoded.validate()
+	if err != nil {
+		return err
+	}
+
+	*p = *decoded
+	return nil
+}
+
+func (p *SyncPlan) blockChecksumJSON(block int64) blockChecksumJSON {
+	checksum := p.blockChecksum(block)
+	return blockChecksumJSON{
+		Block:  block,
+		Weak:   hex.EncodeToString(checksum.WeakChecksum),
+		Strong: hex.EncodeToString(checksum.StrongChecksum),
+	}
+}
+
+func (p *SyncPlan) setBlockChecksumJSON(block int64, encoded blockChecksumJSON) error {
+	if encoded.Block != block {
+		return fmt.Errorf("invalid plan: checksum of block %d found where block %d was expected", encoded.Block,
+			block)
+	}
+
+	weakSum, err := hex.DecodeString(encoded.Weak)
+	if err != nil {
+		return fmt.Errorf("invalid plan: weak checksum of block %d: %w", block, err)
+	}
+
+	strongSum, err := hex.DecodeString(encoded.Strong)
+	if err != nil {
+		return fmt.Errorf("invalid plan: strong checksum of block %d: %w", block, err)
+	}
+
+	return p.setBlockChecksum(block, weakSum, strongSum)
+}
+
+// MarshalBinary encodes the plan in a compact binary form holding the same data as MarshalJSON
+func (p *SyncPlan) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(planMagic)
+	writeUvarint(&buf, planEncodingVersion)
+
+	writeUvarint(&buf, uint64(p.FileLength))
+	writeUvarint(&buf, uint64(p.BlockSize))
+	writeBytes(&buf, []byte(p.SHA1))
+
+	writeUvarint(&buf, uint64(len(p.Seeds)))
+	for _, seed := range p.Seeds {
+		writeBytes(&buf, []byte(seed.Name))
+		writeUvarint(&buf, uint64(seed.Size))
+	}
+
+	writeUvarint(&buf, uint64(len(p.Copies)))
+	for _, chunkCopy := range p.Copies {
+		writeUvarint(&buf, uint64(chunkCopy.Seed))
+		writeUvarint(&buf, uint64(chunkCopy.SourceOffset))
+		writeUvarint(&buf, uint64(chunkCopy.TargetOffset))
+		writeUvarint(&buf, uint64(chunkCopy.Size))
+		p.writeBlockChecksum(&buf, p.blockAt(chunkCopy.TargetOffset))
+	}
+
+	writeUvarint(&buf, uint64(len(p.Downloads)))
+	for _, byteRange := range p.Downloads {
+		writeUvarint(&buf, uint64(byteRange.Begin))
+		writeUvarint(&buf, uint64(byteRange.Size()))
+		for block := p.blockAt(byteRange.Begin); block <= p.blockAt(byteRange.End-1); block++ {
+			p.writeBlockChecksum(&buf, block)
+		}
+	}
+
+	writeUvarint(&buf, uint64(p.Totals.SeedBytesScanned))
+	writeUvarint(&buf, uint64(p.Totals.MatchedChunks))
+	writeUvarint(&buf, uint64(p.Totals.MatchedBytes))
+	writeUvarint(&buf, uint64(p.Totals.ReusedBytes))
+	writeUvarint(&buf, uint64(p.Totals.DownloadedBytes))
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a plan encoded by MarshalBinary
+func (p *SyncPlan) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(planMagic)) {
+		return fmt.Errorf("invalid plan: missing %s header", planMagic)
+	}
+
+	reader := &planReader{reader: bytes.NewReader(data[len(planMagic):])}
+	version := reader.uvarint()
+	if reader.err == nil && version != planEncodingVersion {
+		return fmt.Errorf("unsupported plan version %d", version)
+	}
+
+	fileLength := reader.int64()
+	blockSize := reader.int64()
+	sha1Sum := string(reader.bytes())
+	if reader.err != nil {
+		return reader.err
+	}
+
+	decoded, err := newDecodedPlan(fileLength, blockSize, sha1Sum)
+	if err != nil {
+		return err
+	}
+
+	for i := reader.count(); i > 0 && reader.err == nil; i-- {
+		decoded.Seeds = append(decoded.Seeds, Seed{Name: string(reader.bytes()), Size: reader.int64()})
+	}
+
+	for i := reader.count(); i > 0 && reader.err == nil; i-- {
+		chunkCopy := ChunkCopy{
+			Seed:         int(reader.int64()),
+			SourceOffset: reader.int64(),
+			TargetOffset: reader.int64(),
+			Size:         reader.int64(),
+		}
+		decoded.Copies = append(decoded.Copies, chunkCopy)
+		if reader.err == nil {
+			reader.setErr(decoded.readBlockChecksum(reader, decoded.blockAt(chunkCopy.TargetOffset)))
+		}
+	}
+
+	for i := reader.count(); i > 0 && reader.err == nil; i-- {
+		begin := reader.int64()
+		byteRange := sources.ByteRange{Begin: begin, End: begin + reader.int64()}
+		decoded.Downloads = append(decoded.Downloads, byteRange)
+		if reader.err == nil && byteRange.End <= byteRange.Begin {
+			reader.setErr(fmt.Errorf("invalid plan: empty download range at %d", byteRange.Begin))
+		}
+
+		lastBlock := decoded.blockAt(byteRange.End - 1)
+		for block := decoded.blockAt(byteRange.Begin); block <= lastBlock && reader.err == nil; block++ {
+			reader.setErr(decoded.readBlockChecksum(reader, block))
+		}
+	}
+
+	decoded.Totals = SyncTotals{
+		SeedBytesScanned: reader.int64(),
+		MatchedChunks:    int(reader.int64()),
+		MatchedBytes:     reader.int64(),
+		ReusedBytes:      reader.int64(),
+		DownloadedBytes:  reader.int64(),
+	}
+	if reader.err != nil {
+		return reader.err
+	}
+
+	err = decoded.validate()
+	if err != nil {
+		return err
+	}
+
+	*p = *decoded
+	return nil
+}
+
+func (p *SyncPlan) writeBlockChecksum(buf *bytes.Buffer, block int64) {
+	checksum := p.blockChecksum(block)
+	writeBytes(buf, checksum.WeakChecksum)
+	writeBytes(buf, checksum.StrongChecksum)
+}
+
+func (p *SyncPlan) readBlockChecksum(reader *planReader, block int64) error {
+	weakSum := reader.bytes()
+	strongSum := reader.bytes()
+	if reader.err != nil {
+		return reader.err
+	}
+
+	return p.setBlockChecksum(block, weakSum, strongSum)
+}
+
+func writeUvarint(buf *bytes.Buffer, value uint64) {
+	var encoded [binary.MaxVarintLen64]byte
+	buf.Write(encoded[:binary.PutUvarint(encoded[:], value)])
+}
+
+func writeBytes(buf *bytes.Buffer, value []byte) {
+	writeUvarint(buf, uint64(len(value)))
+	buf.Write(value)
+}
+
+// reads the binary encoding keeping the first error
+type planReader struct {
+	reader *bytes.Reader
+	err    error
+}
+
+func (r *planReader) setErr(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *planReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	value, err := binary.ReadUvarint(r.reader)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	r.setErr(err)
+	return value
+}
+
+func (r *planReader) int64() int64 {
+	value := r.uvarint()
+	if value > 1<<62 {
+		r.setErr(errors.New("invalid plan: value out of range"))
+		return 0
+	}
+
+	return int64(value)
+}
+
+// reads the length of a list, it can't exceed the remaining data since every element takes one byte or more
+func (r *planReader) count() int {
+	value := r.int64()
+	if value > int64(r.reader.Len()) {
+		r.setErr(io.ErrUnexpectedEOF)
+		return 0
+	}
+
+	return int(value)
+}
+
+func (r *planReader) bytes() []byte {
+	value := make([]byte, r.count())
+	if r.err != nil {
+		return nil
+	}
+
+	_, err := io.ReadFull(r.reader, value)
+	r.setErr(err)
+	return value
+}
+
+// creates a plan whose block checksums are filled while decoding
+func newDecodedPlan(fileLength int64, blockSize int64, sha1Sum string) (*SyncPlan, error) {
+	if fileLength < 0 || blockSize <= 0 {
+		return nil, fmt.Errorf("invalid plan: file length %d, block size %d", fileLength, blockSize)
+	}
+
+	blockCount := (fileLength + blockSize - 1) / blockSize
+	return &SyncPlan{
+		FileLength: fileLength,
+		BlockSize:  blockSize,
+		SHA1:       sha1Sum,
+		blocks:     make([]chunks.ChunkChecksum, blockCount),
+	}, nil
+}
+
+// returns the block that contains offset
+func (p *SyncPlan) blockAt(offset int64) int64 {
+	return offset / p.BlockSize
+}
+
+// returns the expected checksums of block, they are empty for the plans created by hand
+func (p *SyncPlan) blockChecksum(block int64) chunks.ChunkChecksum {
+	if block < 0 || block >= int64(len(p.blocks)) {
+		return chunks.ChunkChecksum{}
+	}
+
+	return p.blocks[block]
+}
+
+func (p *SyncPlan) setBlockChecksum(block int64, weakSum []byte, strongSum []byte) error {
+	if block < 0 || block >= int64(len(p.blocks)) {
+		return fmt.Errorf("invalid plan: block %d out of the file", block)
+	}
+
+	p.blocks[block] = chunks.ChunkChecksum{
+		ChunkOffset:    uint(block),
+		WeakChecksum:   weakSum,
+		StrongChecksum: strongSum,
+	}
+	return nil
+}
+
+// sorts the copies and downloads, as Execute expects them, and checks that they are consistent and cover the whole
+// file. The copies and the downloads can overlap each other but not themselves.
+func (p *SyncPlan) validate() error {
+	sort.SliceStable(p.Copies, func(i, j int) bool {
+		return p.Copies[i].TargetOffset < p.Copies[j].TargetOffset
+	})
+	sort.SliceStable(p.Downloads, func(i, j int) bool {
+		return p.Downloads[i].Begin < p.Downloads[j].Begin
+	})
+
+	copied := make([]sources.ByteRange, 0, len(p.Copies))
+	for _, chunkCopy := range p.Copies {
+		if chunkCopy.Seed < 0 || chunkCopy.Seed >= len(p.Seeds) {
+			return fmt.Errorf("invalid plan: chunk at %d copied from unknown seed %d", chunkCopy.TargetOffset,
+				chunkCopy.Seed)
+		}
+
+		if chunkCopy.SourceOffset+chunkCopy.Size > p.Seeds[chunkCopy.Seed].Size {
+			return fmt.Errorf("invalid plan: chunk at %d past the end of its seed", chunkCopy.TargetOffset)
+		}
+
+		if chunkCopy.TargetOffset%p.BlockSize != 0 || chunkCopy.Size > p.BlockSize {
+			return fmt.Errorf("invalid plan: chunk at %d is not a block", chunkCopy.TargetOffset)
+		}
+
+		copied = append(copied, sources.ByteRange{Begin: chunkCopy.TargetOffset,
+			End: chunkCopy.TargetOffset + chunkCopy.Size})
+	}
+
+	for _, ranges := range [][]sources.ByteRange{copied, p.Downloads} {
+		err := checkDisjointRanges(ranges)
+		if err != nil {
+			return err
+		}
+	}
+
+	covered := append(copied, p.Downloads...)
+	sort.Slice(covered, func(i, j int) bool {
+		return covered[i].Begin < covered[j].Begin
+	})
+
+	var end int64
+	for _, byteRange := range covered {
+		if byteRange.Begin > end {
+			return fmt.Errorf("invalid plan: bytes at %d are not written", end)
+		}
+
+		if byteRange.End > end {
+			end = byteRange.End
+		}
+	}
+
+	if end != p.FileLength {
+		return fmt.Errorf("invalid plan: bytes at %d are not written", end)
+	}
+
+	return nil
+}
+
+// checks that the sorted ranges don't overlap
+func checkDisjointRanges(ranges []sources.ByteRange) error {
+	for i, byteRange := range ranges {
+		if byteRange.Begin < 0 || byteRange.End < byteRange.Begin {
+			return fmt.Errorf("invalid plan: invalid range %d-%d", byteRange.Begin, byteRange.End)
+		}
+
+		if i > 0 && byteRange.Begin < ranges[i-1].End {
+			return fmt.Errorf("invalid plan: bytes at %d are written twice", byteRange.Begin)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,270 @@
+package zsync
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/AppImageCrafters/libzsync-go/sources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZSync2_PlanAndExecute(t *testing.T) {
+	seedPath := dataDir + "/1st_and_3rd_chunks_changed"
+	_ = GenerateSampleFile([]byte("x1y"), 2048*2+60, 0, seedPath)
+	defer os.Remove(seedPath)
+
+	server, requestedRanges := newRangesRecordingServer(true)
+	defer server.Close()
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = server.URL + "/file"
+	zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+	zsync := NewZSyncFromControl(zsyncControl)
+
+	plan, err := zsync.Plan(seedPath)
+	assert.Nil(t, err)
+	defer plan.Close()
+
+	assert.Empty(t, *requestedRanges)
+	assert.Equal(t, []ChunkCopy{{Seed: 0, SourceOffset: 2048, TargetOffset: 2048, Size: 2048}}, plan.Copies)
+	assert.Equal(t, []sources.ByteRange{{Begin: 0, End: 2048}, {Begin: 4096, End: 4156}}, plan.Downloads)
+	assert.Equal(t, int64(2048), plan.Totals.ReusedBytes)
+	assert.Equal(t, int64(2048+60), plan.Totals.DownloadedBytes)
+
+	output := &bytesWriteSeeker{}
+	totals, err := zsync.Execute(plan, output)
+	assert.Nil(t, err)
+
+	expected, _ := ioutil.ReadFile(dataDir + "/file")
+	assert.Equal(t, expected, output.data)
+	assert.Equal(t, []string{"bytes=0-2047,4096-4155"}, *requestedRanges)
+	assert.Equal(t, plan.Totals.DownloadedBytes, totals.DownloadedBytes)
+	assert.Equal(t, 1, totals.HttpRequests)
+}
+
+func TestZSync2_ExecuteInvalidPlan(t *testing.T) {
+	zsyncControl, _ := getControl("file.zsync")
+	zsync := NewZSyncFromControl(zsyncControl)
+
+	plan := &SyncPlan{FileLength: zsync.RemoteFileSize, BlockSize: zsync.BlockSize,
+		Copies: []ChunkCopy{{Seed: 1, Size: 2048}}}
+	_, err := zsync.Execute(plan, &bytesWriteSeeker{})
+	assert.NotNil(t, err)
+
+	plan = &SyncPlan{FileLength: 10, BlockSize: zsync.BlockSize}
+	_, err = zsync.Execute(plan, &bytesWriteSeeker{})
+	assert.NotNil(t, err)
+}
+
+func TestSyncPlan_Encoding(t *testing.T) {
+	seedPath := dataDir + "/plan_seed"
+	_ = GenerateSampleFile([]byte("x1y"), 2048*2+60, 0, seedPath)
+	defer os.Remove(seedPath)
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = serverUrl + "file"
+	zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+	zsync := NewZSyncFromControl(zsyncControl)
+
+	plan, err := zsync.Plan(seedPath)
+	assert.Nil(t, err)
+	plan.Close()
+
+	jsonPlan, err := json.Marshal(plan)
+	assert.Nil(t, err)
+	binaryPlan, err := plan.MarshalBinary()
+	assert.Nil(t, err)
+	assert.True(t, len(binaryPlan) < len(jsonPlan))
+
+	decoders := map[string]func(plan *SyncPlan) error{
+		"json":   func(plan *SyncPlan) error { return json.Unmarshal(jsonPlan, plan) },
+		"binary": func(plan *SyncPlan) error { return plan.UnmarshalBinary(binaryPlan) },
+	}
+
+	for name, decode := range decoders {
+		t.Run(name, func(t *testing.T) {
+			decoded := &SyncPlan{}
+			assert.Nil(t, decode(decoded))
+
+			assert.Equal(t, plan.FileLength, decoded.FileLength)
+			assert.Equal(t, plan.BlockSize, decoded.BlockSize)
+			assert.Equal(t, plan.SHA1, decoded.SHA1)
+			assert.Equal(t, []Seed{{Name: seedPath, Size: 2048*2 + 60}}, decoded.Seeds)
+			assert.Equal(t, plan.Copies, decoded.Copies)
+			assert.Equal(t, plan.Downloads, decoded.Downloads)
+			assert.Equal(t, plan.Totals.DownloadedBytes, decoded.Totals.DownloadedBytes)
+			assert.Equal(t, plan.blocks, decoded.blocks)
+
+			assert.Nil(t, decoded.OpenSeeds())
+			defer decoded.Close()
+			assert.Nil(t, zsync.CheckPlan(decoded))
+
+			output := &bytesWriteSeeker{}
+			_, err := zsync.Execute(decoded, output)
+			assert.Nil(t, err)
+
+			expected, _ := ioutil.ReadFile(dataDir + "/file")
+			assert.Equal(t, expected, output.data)
+		})
+	}
+}
+
+func TestSyncPlan_EncodingCoalescedDownloads(t *testing.T) {
+	seedPath := dataDir + "/plan_coalesced_seed"
+	_ = GenerateSampleFile([]byte("x1y"), 2048*2+60, 0, seedPath)
+	defer os.Remove(seedPath)
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = serverUrl + "file"
+	zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+	zsync := NewZSyncFromControl(zsyncControl)
+	zsync.MaxRangeGap = 2048
+
+	plan, err := zsync.Plan(seedPath)
+	assert.Nil(t, err)
+	plan.Close()
+
+	// the download coalesced over the gap also covers the copied chunk
+	assert.Equal(t, []ChunkCopy{{Seed: 0, SourceOffset: 2048, TargetOffset: 2048, Size: 2048}}, plan.Copies)
+	assert.Equal(t, []sources.ByteRange{{Begin: 0, End: 4156}}, plan.Downloads)
+
+	jsonPlan, err := json.Marshal(plan)
+	assert.Nil(t, err)
+	binaryPlan, err := plan.MarshalBinary()
+	assert.Nil(t, err)
+
+	for name, decode := range map[string]func(plan *SyncPlan) error{
+		"json":   func(plan *SyncPlan) error { return json.Unmarshal(jsonPlan, plan) },
+		"binary": func(plan *SyncPlan) error { return plan.UnmarshalBinary(binaryPlan) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			decoded := &SyncPlan{}
+			assert.Nil(t, decode(decoded))
+			assert.Equal(t, plan.Copies, decoded.Copies)
+			assert.Equal(t, plan.Downloads, decoded.Downloads)
+
+			assert.Nil(t, decoded.OpenSeeds())
+			defer decoded.Close()
+			assert.Nil(t, zsync.CheckPlan(decoded))
+
+			output := &bytesWriteSeeker{}
+			_, err := zsync.Execute(decoded, output)
+			assert.Nil(t, err)
+
+			expected, _ := ioutil.ReadFile(dataDir + "/file")
+			assert.Equal(t, expected, output.data)
+		})
+	}
+
+	// the downloads alone can't overlap
+	decoded := &SyncPlan{}
+	assert.Nil(t, json.Unmarshal(jsonPlan, decoded))
+	decoded.Downloads = append(decoded.Downloads, sources.ByteRange{Begin: 4000, End: 4156})
+	assert.NotNil(t, decoded.validate())
+}
+
+func TestSyncPlan_DecodeUnsorted(t *testing.T) {
+	seedPath := dataDir + "/plan_unsorted_seed"
+	_ = GenerateSampleFile([]byte("x1y"), 2048*2+60, 0, seedPath)
+	defer os.Remove(seedPath)
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = serverUrl + "file"
+	zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+	zsync := NewZSyncFromControl(zsyncControl)
+
+	// two copies from the first seed and two downloads for the second one
+	for _, seed := range []string{dataDir + "/1st_chunk_changed", seedPath} {
+		plan, err := zsync.Plan(seed)
+		assert.Nil(t, err)
+		plan.Close()
+		assert.Equal(t, 3, len(plan.Copies)+len(plan.Downloads))
+
+		sortedCopies := append([]ChunkCopy(nil), plan.Copies...)
+		sortedDownloads := append([]sources.ByteRange(nil), plan.Downloads...)
+		for i, j := 0, len(plan.Copies)-1; i < j; i, j = i+1, j-1 {
+			plan.Copies[i], plan.Copies[j] = plan.Copies[j], plan.Copies[i]
+		}
+		for i, j := 0, len(plan.Downloads)-1; i < j; i, j = i+1, j-1 {
+			plan.Downloads[i], plan.Downloads[j] = plan.Downloads[j], plan.Downloads[i]
+		}
+
+		jsonPlan, err := json.Marshal(plan)
+		assert.Nil(t, err)
+		binaryPlan, err := plan.MarshalBinary()
+		assert.Nil(t, err)
+
+		for name, decode := range map[string]func(plan *SyncPlan) error{
+			"json":   func(plan *SyncPlan) error { return json.Unmarshal(jsonPlan, plan) },
+			"binary": func(plan *SyncPlan) error { return plan.UnmarshalBinary(binaryPlan) },
+		} {
+			decoded := &SyncPlan{}
+			assert.Nil(t, decode(decoded), name)
+			assert.Equal(t, sortedCopies, decoded.Copies, name)
+			assert.Equal(t, sortedDownloads, decoded.Downloads, name)
+
+			assert.Nil(t, decoded.OpenSeeds())
+			output := &bytesWriteSeeker{}
+			_, err = zsync.Execute(decoded, output)
+			decoded.Close()
+			assert.Nil(t, err, name)
+
+			expected, _ := ioutil.ReadFile(dataDir + "/file")
+			assert.Equal(t, expected, output.data, name)
+		}
+	}
+}
+
+func TestZSync2_CheckPlanChangedSeed(t *testing.T) {
+	seedPath := dataDir + "/plan_changed_seed"
+	_ = GenerateSampleFile([]byte("x1y"), 2048*2+60, 0, seedPath)
+	defer os.Remove(seedPath)
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+	zsync := NewZSyncFromControl(zsyncControl)
+
+	plan, err := zsync.Plan(seedPath)
+	assert.Nil(t, err)
+	plan.Close()
+
+	encoded, _ := json.Marshal(plan)
+
+	// same size, different content
+	_ = GenerateSampleFile([]byte("abc"), 2048*2+60, 0, seedPath)
+	decoded := &SyncPlan{}
+	assert.Nil(t, json.Unmarshal(encoded, decoded))
+	assert.Nil(t, decoded.OpenSeeds())
+	defer decoded.Close()
+
+	assert.NotNil(t, zsync.CheckPlan(decoded))
+}
+
+func TestSyncPlan_DecodeInvalid(t *testing.T) {
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+	plan, err := NewZSyncFromControl(zsyncControl).Plan(dataDir + "/1st_chunk_changed")
+	assert.Nil(t, err)
+	plan.Close()
+
+	binaryPlan, _ := plan.MarshalBinary()
+	for i := 0; i < len(binaryPlan); i++ {
+		assert.NotNil(t, (&SyncPlan{}).UnmarshalBinary(binaryPlan[:i]), i)
+	}
+
+	var jsonPlan map[string]interface{}
+	encoded, _ := json.Marshal(plan)
+	_ = json.Unmarshal(encoded, &jsonPlan)
+
+	jsonPlan["version"] = 2
+	encoded, _ = json.Marshal(jsonPlan)
+	assert.NotNil(t, json.Unmarshal(encoded, &SyncPlan{}))
+
+	// the remote file is not covered
+	jsonPlan["version"] = 1
+	jsonPlan["downloads"] = []interface{}{}
+	encoded, _ = json.Marshal(jsonPlan)
+	assert.NotNil(t, json.Unmarshal(encoded, &SyncPlan{}))
+}
@@ -0,0 +1,110 @@
+package zsync
+
+import (
+	"time"
+
+	"github.com/AppImageCrafters/libzsync-go/chunks"
+	"github.com/AppImageCrafters/libzsync-go/sources"
+)
+
+// bytes scanned by a seed worker before notifying the observer
+const seedScanNotificationStep = 1 << 20
+
+// SyncTotals summarizes a sync
+type SyncTotals struct {
+	SeedBytesScanned int64
+	// blocks of the remote file found in the seeds and their size
+	MatchedChunks int
+	MatchedBytes  int64
+	// bytes copied from the seeds, the matched bytes between coalesced missing ranges are downloaded instead
+	ReusedBytes int64
+	// size of the ranges requested
+	DownloadedBytes int64
+	// how the missing ranges were fetched
+	Strategy DownloadStrategy
+
+	// requests sent for the remote file, including the failed ones
+	HttpRequests int
+	// response body bytes received
+	ReceivedBytes int64
+	// received bytes that don't belong to the missing blocks, like the gaps between coalesced ranges, the multipart
+	// headers or the data skipped while streaming the remote file
+	OverheadBytes int64
+
+	// time spent scanning the seeds, writing the output and verifying its checksum
+	ScanDuration     time.Duration
+	DownloadDuration time.Duration
+	VerifyDuration   time.Duration
+}
+
+// missingBytes are the bytes of the remote file that had to be downloaded
+func (t *SyncTotals) setTransferStats(stats *sources.TransferStats, missingBytes int64) {
+	t.HttpRequests = stats.Requests()
+	t.ReceivedBytes = stats.ReceivedBytes()
+	t.OverheadBytes = 0
+	if t.ReceivedBytes > missingBytes {
+		t.OverheadBytes = t.ReceivedBytes - missingBytes
+	}
+}
+
+// ProgressObserver receives the progress of a sync. OnSeedScanned and OnChunkMatched are called from the seed
+// scanning workers, therefore they may be called concurrently. The same applies to OnDownloadProgress when
+// ZSync.DownloadConcurrency is greater than 1.
+type ProgressObserver interface {
+	// a worker scanned n more bytes of the seed
+	OnSeedScanned(n int64)
+	// a seed chunk matches a block of the remote file
+	OnChunkMatched(chunk chunks.ChunkInfo)
+	// the seed scan is complete, reusedBytes will be copied from the seed and missingBytes will be downloaded
+	OnSyncPlanned(reusedBytes int64, missingBytes int64)
+	// received bytes of the remote range [rangeBegin, rangeEnd)
+	OnDownloadProgress(rangeBegin int64, rangeEnd int64, received int64)
+	// the output was completely written
+	OnSyncFinished(totals SyncTotals)
+}
+
+func (zsync *ZSync) notifySeedScanned(n int64) {
+	if zsync.Observer != nil && n > 0 {
+		zsync.Observer.OnSeedScanned(n)
+	}
+}
+
+func (zsync *ZSync) notifyChunkMatched(chunk chunks.ChunkInfo) {
+	if zsync.Observer != nil {
+		zsync.Observer.OnChunkMatched(chunk)
+	}
+}
+
+func (zsync *ZSync) notifySyncPlanned(reusedBytes int64, missingBytes int64) {
+	if zsync.Observer != nil {
+		zsync.Observer.OnSyncPlanned(reusedBytes, missingBytes)
+	}
+}
+
+func (zsync *ZSync) notifyDownloadProgress(rangeBegin int64, rangeEnd int64, received int64) {
+	if zsync.Observer != nil {
+		zsync.Observer.OnDownloadProgress(rangeBegin, rangeEnd, received)
+	}
+}
+
+func (zsync *ZSync) notifySyncFinished(totals SyncTotals) {
+	if zsync.Observer != nil {
+		zsync.Observer.OnSyncFinished(totals)
+	}
+}
+
+func sumChunkSizes(chunkList []chunks.ChunkInfo) (total int64) {
+	for _, chunk := range chunkList {
+		total += chunk.Size
+	}
+
+	return total
+}
+
+func sumRangeSizes(ranges []sources.ByteRange) (total int64) {
+	for _, r := range ranges {
+		total += r.Size()
+	}
+
+	return total
+}
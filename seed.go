@@ -0,0 +1,75 @@
+package zsync
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Seed is local data that may contain chunks of the remote file, like an older version of it. Seeds are read
+// concurrently through ReadAt, therefore they can come from memory, archives or any other io.ReaderAt.
+type Seed struct {
+	// identifies the seed in the errors
+	Name   string
+	Reader io.ReaderAt
+	Size   int64
+
+	closer io.Closer
+}
+
+// NewSeed creates a seed from the first size bytes of reader
+func NewSeed(name string, reader io.ReaderAt, size int64) Seed {
+	return Seed{Name: name, Reader: reader, Size: size}
+}
+
+// OpenSeed opens the file at path as a seed, it must be closed after use
+func OpenSeed(path string) (Seed, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Seed{}, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return Seed{}, err
+	}
+
+	if stat.IsDir() {
+		_ = file.Close()
+		return Seed{}, fmt.Errorf("unable to use %s as seed: is a directory", path)
+	}
+
+	return Seed{Name: path, Reader: file, Size: stat.Size(), closer: file}, nil
+}
+
+// Close releases the resources of the seeds created with OpenSeed or OpenSeedFS
+func (s Seed) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+
+	return s.closer.Close()
+}
+
+// opens the seed files, the returned function closes them
+func openSeeds(paths []string) ([]Seed, func(), error) {
+	var seeds []Seed
+	closeSeeds := func() {
+		for _, seed := range seeds {
+			_ = seed.Close()
+		}
+	}
+
+	for _, path := range paths {
+		seed, err := OpenSeed(path)
+		if err != nil {
+			closeSeeds()
+			return nil, nil, err
+		}
+
+		seeds = append(seeds, seed)
+	}
+
+	return seeds, closeSeeds, nil
+}
@@ -0,0 +1,43 @@
+//go:build go1.16
+// +build go1.16
+
+package zsync
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// OpenSeedFS opens the file name of fsys as a seed, it must be closed after use. Files that don't implement
+// io.ReaderAt are loaded in memory.
+func OpenSeedFS(fsys fs.FS, name string) (Seed, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return Seed{}, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return Seed{}, err
+	}
+
+	if stat.IsDir() {
+		_ = file.Close()
+		return Seed{}, fmt.Errorf("unable to use %s as seed: is a directory", name)
+	}
+
+	if reader, ok := file.(io.ReaderAt); ok {
+		return Seed{Name: name, Reader: reader, Size: stat.Size(), closer: file}, nil
+	}
+
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return Seed{}, fmt.Errorf("unable to read %s: %w", name, err)
+	}
+
+	return NewSeed(name, bytes.NewReader(data), int64(len(data))), nil
+}
@@ -0,0 +1,42 @@
+//go:build go1.16
+// +build go1.16
+
+package zsync
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenSeedFS(t *testing.T) {
+	expected, _ := ioutil.ReadFile(dataDir + "/file")
+
+	server, requestedRanges := newRangesRecordingServer(true)
+	defer server.Close()
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = server.URL + "/file"
+
+	fsys := fstest.MapFS{"old/file": &fstest.MapFile{Data: expected}}
+	seed, err := OpenSeedFS(fsys, "old/file")
+	assert.Nil(t, err)
+	defer seed.Close()
+
+	output := &bytesWriteSeeker{}
+	_, err = NewZSyncFromControl(zsyncControl).SyncReaders([]Seed{seed}, output)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, output.data)
+	assert.Empty(t, *requestedRanges)
+
+	dirSeed, err := OpenSeedFS(os.DirFS(dataDir), "file")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(expected)), dirSeed.Size)
+	assert.Nil(t, dirSeed.Close())
+
+	_, err = OpenSeedFS(os.DirFS(dataDir), ".")
+	assert.NotNil(t, err)
+}
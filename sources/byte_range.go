@@ -0,0 +1,69 @@
+package sources
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ByteRange represents the bytes [Begin, End) of a file
+type ByteRange struct {
+	Begin int64
+	End   int64
+}
+
+func (r ByteRange) Size() int64 {
+	return r.End - r.Begin
+}
+
+// RangeHandler consumes the content of a range received from a source
+type RangeHandler func(byteRange ByteRange, body io.Reader) error
+
+// CoalesceRanges merges the sorted ranges separated by maxGap bytes or less
+func CoalesceRanges(ranges []ByteRange, maxGap int64) []ByteRange {
+	var result []ByteRange
+	for _, r := range ranges {
+		last := len(result) - 1
+		if last >= 0 && r.Begin-result[last].End <= maxGap {
+			if r.End > result[last].End {
+				result[last].End = r.End
+			}
+			continue
+		}
+
+		result = append(result, r)
+	}
+
+	return result
+}
+
+// formats ranges as a HTTP Range header value, notice that HTTP ranges are inclusive
+func formatRangeSpecifier(ranges []ByteRange) string {
+	specs := make([]string, len(ranges))
+	for i, r := range ranges {
+		specs[i] = fmt.Sprintf("%d-%d", r.Begin, r.End-1)
+	}
+
+	return "bytes=" + strings.Join(specs, ",")
+}
+
+// parses a Content-Range header value like "bytes 0-99/1234", total is -1 if the file size is unknown ("*")
+func parseContentRange(value string) (byteRange ByteRange, total int64, err error) {
+	var begin, last int64
+	var totalValue string
+	_, err = fmt.Sscanf(value, "bytes %d-%d/%s", &begin, &last, &totalValue)
+	if err != nil || last < begin {
+		return ByteRange{}, 0, fmt.Errorf("invalid Content-Range: \"%s\"", value)
+	}
+
+	total = -1
+	if totalValue != "*" {
+		total, err = strconv.ParseInt(totalValue, 10, 64)
+		if err != nil || total <= last {
+			return ByteRange{}, 0, fmt.Errorf("invalid Content-Range: \"%s\"", value)
+		}
+	}
+
+	return ByteRange{Begin: begin, End: last + 1}, total, nil
+}
@@ -0,0 +1,41 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalesceRanges(t *testing.T) {
+	ranges := []ByteRange{{0, 10}, {10, 20}, {25, 30}, {40, 50}}
+
+	assert.Equal(t, []ByteRange{{0, 20}, {25, 30}, {40, 50}}, CoalesceRanges(ranges, 0))
+	assert.Equal(t, []ByteRange{{0, 30}, {40, 50}}, CoalesceRanges(ranges, 5))
+	assert.Equal(t, []ByteRange{{0, 50}}, CoalesceRanges(ranges, 10))
+	assert.Nil(t, CoalesceRanges(nil, 10))
+}
+
+func TestFormatRangeSpecifier(t *testing.T) {
+	assert.Equal(t, "bytes=0-9,25-29", formatRangeSpecifier([]ByteRange{{0, 10}, {25, 30}}))
+}
+
+func TestParseContentRange(t *testing.T) {
+	r, total, err := parseContentRange("bytes 25-29/100")
+	assert.Nil(t, err)
+	assert.Equal(t, ByteRange{25, 30}, r)
+	assert.Equal(t, int64(100), total)
+
+	r, total, err = parseContentRange("bytes 25-29/*")
+	assert.Nil(t, err)
+	assert.Equal(t, ByteRange{25, 30}, r)
+	assert.Equal(t, int64(-1), total)
+
+	_, _, err = parseContentRange("bytes */100")
+	assert.NotNil(t, err)
+
+	_, _, err = parseContentRange("bytes 25-29/20")
+	assert.NotNil(t, err)
+
+	_, _, err = parseContentRange("")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,41 @@
+package sources
+
+import (
+	"net/url"
+	"sync"
+)
+
+// ConnectionLimiter limits the number of concurrent requests sent to each host, it can be shared by several sources
+type ConnectionLimiter struct {
+	MaxPerHost int
+
+	mutex sync.Mutex
+	slots map[string]chan bool
+}
+
+func NewConnectionLimiter(maxPerHost int) *ConnectionLimiter {
+	return &ConnectionLimiter{MaxPerHost: maxPerHost, slots: make(map[string]chan bool)}
+}
+
+// Acquire blocks until a connection to the host of rawUrl is available, the returned function releases it
+func (l *ConnectionLimiter) Acquire(rawUrl string) (release func()) {
+	if l == nil || l.MaxPerHost < 1 {
+		return func() {}
+	}
+
+	host := rawUrl
+	if parsedUrl, err := url.Parse(rawUrl); err == nil {
+		host = parsedUrl.Host
+	}
+
+	l.mutex.Lock()
+	hostSlots, ok := l.slots[host]
+	if !ok {
+		hostSlots = make(chan bool, l.MaxPerHost)
+		l.slots[host] = hostSlots
+	}
+	l.mutex.Unlock()
+
+	hostSlots <- true
+	return func() { <-hostSlots }
+}
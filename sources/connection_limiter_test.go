@@ -0,0 +1,47 @@
+package sources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionLimiter_Acquire(t *testing.T) {
+	limiter := NewConnectionLimiter(1)
+
+	release := limiter.Acquire("http://example.com/file")
+	// other hosts aren't affected
+	limiter.Acquire("http://mirror.example.com/file")()
+
+	acquired := make(chan bool)
+	go func() {
+		limiter.Acquire("http://example.com/other_file")()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("the connection limit was exceeded")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection was not released")
+	}
+}
+
+func TestConnectionLimiter_Unlimited(t *testing.T) {
+	var limiter *ConnectionLimiter
+	limiter.Acquire("http://example.com/file")()
+
+	limiter = NewConnectionLimiter(0)
+	for i := 0; i < 10; i++ {
+		limiter.Acquire("http://example.com/file")
+	}
+
+	assert.Empty(t, limiter.slots)
+}
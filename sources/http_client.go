@@ -0,0 +1,82 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+)
+
+// RequestModifier is called before sending each request, it can be used to add headers or credentials
+type RequestModifier func(request *http.Request) error
+
+// HttpClient sends the HTTP requests, it allows to configure timeouts, proxies, TLS settings and authentication
+// in a single place. A nil *HttpClient uses http.DefaultClient.
+type HttpClient struct {
+	// optional, http.DefaultClient is used if nil
+	Client *http.Client
+	// optional
+	ModifyRequest RequestModifier
+}
+
+func (c *HttpClient) Do(request *http.Request) (*http.Response, error) {
+	client := http.DefaultClient
+	if c != nil && c.Client != nil {
+		client = c.Client
+	}
+
+	if c != nil && c.ModifyRequest != nil {
+		err := c.ModifyRequest(request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return client.Do(request)
+}
+
+func (c *HttpClient) Get(ctx context.Context, url string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(request)
+}
+
+// WithHeaders sets the given headers, like User-Agent, on every request
+func WithHeaders(headers map[string]string) RequestModifier {
+	return func(request *http.Request) error {
+		for k, v := range headers {
+			request.Header.Set(k, v)
+		}
+
+		return nil
+	}
+}
+
+func WithBasicAuth(username string, password string) RequestModifier {
+	return func(request *http.Request) error {
+		request.SetBasicAuth(username, password)
+		return nil
+	}
+}
+
+func WithBearerToken(token string) RequestModifier {
+	return func(request *http.Request) error {
+		request.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
+
+// ChainRequestModifiers applies the modifiers in order
+func ChainRequestModifiers(modifiers ...RequestModifier) RequestModifier {
+	return func(request *http.Request) error {
+		for _, modifier := range modifiers {
+			err := modifier(request)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,32 @@
+package sources
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainRequestModifiers(t *testing.T) {
+	request, _ := http.NewRequest("GET", "http://example.com/file", nil)
+
+	modifier := ChainRequestModifiers(
+		WithHeaders(map[string]string{"User-Agent": "test"}),
+		WithBearerToken("token"),
+	)
+	err := modifier(request)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "test", request.UserAgent())
+	assert.Equal(t, "Bearer token", request.Header.Get("Authorization"))
+}
+
+func TestHttpClient_DoModifierError(t *testing.T) {
+	request, _ := http.NewRequest("GET", "http://example.com/file", nil)
+	modifierErr := errors.New("no credentials")
+
+	client := &HttpClient{ModifyRequest: func(request *http.Request) error { return modifierErr }}
+	_, err := client.Do(request)
+	assert.Equal(t, modifierErr, err)
+}
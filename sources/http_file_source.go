@@ -1,23 +1,59 @@
 package sources
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"sort"
 	"strings"
 )
 
+var errMultiRangeUnsupported = errors.New("multiple ranges per request not supported")
+
+var errBodyTooLong = errors.New("response body longer than expected")
+
+// ErrRangeNotSupported is returned when the server ignores a range request and answers with the whole file
+var ErrRangeNotSupported = errors.New("ranged request not supported")
+
+// ProgressFunc receives the requested range [rangeBegin, rangeEnd) and the number of bytes received from it
+type ProgressFunc func(rangeBegin int64, rangeEnd int64, received int64)
+
 type HttpFileSource struct {
 	URL    string
 	Offset int64
 	Size   int64
+	// requests are aborted once Ctx is done, context.Background() is used if nil
+	Ctx context.Context
+	// optional, called after every read
+	OnProgress ProgressFunc
+	// optional, limits the concurrent ReadRanges requests per host
+	Limiter *ConnectionLimiter
+	// optional, detects changes of the remote file between requests. A private one is used if nil
+	Validator *RemoteValidator
+	// optional, sends the requests
+	HttpClient *HttpClient
+	// optional, failed ReadRanges requests are not retried if nil
+	RetryPolicy *RetryPolicy
+	// optional, counts the requests and the received bytes
+	Stats *TransferStats
 
 	cacheBegin  int64
 	cacheEnd    int64
 	readerCache io.ReadCloser
+
+	multiRangeUnsupported bool
 }
 
 func (h *HttpFileSource) Read(b []byte) (n int, err error) {
+	if h.Size > 0 && h.Offset >= h.Size {
+		return 0, io.EOF
+	}
+
 	if h.readerCache != nil &&
 		(h.Offset < h.cacheBegin || h.Offset+int64(len(b)) > h.cacheEnd) {
 		_ = h.readerCache.Close()
@@ -33,6 +69,10 @@ func (h *HttpFileSource) Read(b []byte) (n int, err error) {
 
 	n, err = h.readerCache.Read(b)
 	_, _ = h.Seek(int64(n), 1)
+	if n > 0 && h.OnProgress != nil {
+		h.OnProgress(h.cacheBegin, h.cacheEnd, h.Offset-h.cacheBegin)
+	}
+
 	return n, err
 }
 
@@ -51,9 +91,13 @@ func (h *HttpFileSource) Seek(offset int64, whence int) (int64, error) {
 	return offset, nil
 }
 
+// Request the next size bytes, the request is trimmed to the end of the file if Size is known
 func (h *HttpFileSource) Request(size int64) (err error) {
 	h.cacheBegin = h.Offset
 	h.cacheEnd = h.Offset + size
+	if h.Size > 0 && h.cacheEnd > h.Size {
+		h.cacheEnd = h.Size
+	}
 
 	h.readerCache, err = h.doRangeRequest(h.cacheBegin, h.cacheEnd)
 	if err != nil {
@@ -62,35 +106,483 @@ func (h *HttpFileSource) Request(size int64) (err error) {
 	return nil
 }
 
-func (h *HttpFileSource) doRangeRequest(range_start int64, range_end int64) (io.ReadCloser, error) {
-	// fmt.Println("Requesting chunk: ", range_start, range_end)
-	rangedRequest, err := http.NewRequest("GET", h.URL, nil)
+// ReadRanges requests several ranges at once and calls handler with the content of each one in the order sent by
+// the server. Servers that don't support multiple ranges per request are queried one range at a time, the ranges
+// missing from a response are requested again. Failed requests are retried according to RetryPolicy, only the bytes
+// not yet passed to handler are requested again.
+func (h *HttpFileSource) ReadRanges(ranges []ByteRange, handler RangeHandler) error {
+	return h.retryRanges(ranges, handler, h.readPendingRanges)
+}
+
+// StreamRanges requests the whole file and calls handler with the content of each range as the body is received.
+// It's meant for servers that ignore range requests, ranges must be sorted and must not overlap. Failed requests
+// are retried according to RetryPolicy.
+func (h *HttpFileSource) StreamRanges(ranges []ByteRange, handler RangeHandler) error {
+	return h.retryRanges(ranges, handler, h.streamRanges)
+}
+
+// calls read until every range is passed to handler or the RetryPolicy gives up
+func (h *HttpFileSource) retryRanges(ranges []ByteRange, handler RangeHandler,
+	read func(ranges []ByteRange, handler RangeHandler, delivered *[]ByteRange) error) error {
+	pending := ranges
+	failures := 0
+	for {
+		var delivered []ByteRange
+		err := read(pending, handler, &delivered)
+		if err == nil {
+			return nil
+		}
+
+		pending = subtractRanges(pending, delivered)
+		for _, r := range delivered {
+			if r.Size() > 0 {
+				// the attempt made progress
+				failures = 0
+			}
+		}
+
+		failures++
+		delay, retry := h.RetryPolicy.nextDelay(err, failures)
+		if !retry || h.ctx().Err() != nil {
+			return err
+		}
+
+		sleepErr := sleepContext(h.ctx(), delay)
+		if sleepErr != nil {
+			return sleepErr
+		}
+	}
+}
+
+// requests the ranges until they are all received, servers may answer with a subset of them. A response without
+// any of the pending ranges fails with a TransientError, so RetryPolicy decides whether to try again.
+func (h *HttpFileSource) readPendingRanges(ranges []ByteRange, handler RangeHandler, delivered *[]ByteRange) error {
+	for len(ranges) > 0 {
+		start := len(*delivered)
+		err := h.requestRanges(ranges, handler, delivered)
+		if err != nil {
+			return err
+		}
+
+		missing := subtractRanges(ranges, (*delivered)[start:])
+		if len(missing) > 0 && rangesEqual(missing, ranges) {
+			return &TransientError{Err: fmt.Errorf("incomplete response from \"%s\": %s not received", h.URL,
+				formatRangeSpecifier(missing))}
+		}
+
+		ranges = missing
+	}
+
+	return nil
+}
+
+func rangesEqual(a []ByteRange, b []ByteRange) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (h *HttpFileSource) requestRanges(ranges []ByteRange, handler RangeHandler, delivered *[]ByteRange) error {
+	if len(ranges) > 1 && !h.multiRangeUnsupported {
+		err := h.readRanges(ranges, handler, delivered)
+		if err != errMultiRangeUnsupported {
+			return err
+		}
+
+		// request the ranges one by one from now on
+		h.multiRangeUnsupported = true
+	}
+
+	for _, r := range ranges {
+		err := h.readRanges([]ByteRange{r}, handler, delivered)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *HttpFileSource) readRanges(ranges []ByteRange, handler RangeHandler, delivered *[]ByteRange) error {
+	release := h.Limiter.Acquire(h.URL)
+	defer release()
+
+	response, err := h.doRequest(formatRangeSpecifier(ranges))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 206 {
+		if len(ranges) > 1 {
+			return errMultiRangeUnsupported
+		}
+
+		return ErrRangeNotSupported
+	}
+
+	mediaType, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		err = h.checkRangeResponse(response, ranges, false)
+		if err != nil {
+			return err
+		}
+
+		byteRange, _ := h.parseContentRange(response.Header.Get("Content-Range"))
+		return h.handlePart(byteRange, response.Body, ranges, handler, delivered)
+	}
+
+	partsReader := multipart.NewReader(response.Body, params["boundary"])
+	for {
+		part, err := partsReader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return &TransientError{Err: fmt.Errorf("invalid multipart/byteranges response: %s", err.Error())}
+		}
+
+		byteRange, err := h.parseContentRange(part.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+
+		if receivedRanges(byteRange, ranges) == nil {
+			return fmt.Errorf("invalid response from \"%s\": unexpected Content-Range %s", h.URL,
+				part.Header.Get("Content-Range"))
+		}
+
+		err = h.handlePart(byteRange, part, ranges, handler, delivered)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (h *HttpFileSource) streamRanges(ranges []ByteRange, handler RangeHandler, delivered *[]ByteRange) error {
+	release := h.Limiter.Acquire(h.URL)
+	defer release()
+
+	response, err := h.doRequest("")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return fmt.Errorf("unexpected response from \"%s\": %s", h.URL, response.Status)
+	}
+
+	if h.Size > 0 && response.ContentLength >= 0 && response.ContentLength != h.Size {
+		return fmt.Errorf("%w: \"%s\" size is %d instead of %d", ErrRemoteChanged, h.URL, response.ContentLength,
+			h.Size)
+	}
+
+	return h.handleRanges(0, response.Body, ranges, handler, delivered)
+}
+
+// passes the requested ranges contained in a part of the response to handler. The part is a requested range, a
+// subset of one or, as allowed by RFC 7233, several requested ranges merged by the server. In such case the bytes
+// between them are skipped.
+func (h *HttpFileSource) handlePart(byteRange ByteRange, body io.Reader, requested []ByteRange, handler RangeHandler,
+	delivered *[]ByteRange) error {
+	received := receivedRanges(byteRange, requested)
+	if len(received) == 1 && received[0] == byteRange {
+		return h.handleRange(byteRange, body, handler, delivered)
+	}
+
+	exactBody := &exactReader{reader: body, remaining: byteRange.Size()}
+	err := h.handleRanges(byteRange.Begin, exactBody, received, handler, delivered)
+	if err != nil {
+		return err
+	}
+
+	return exactBody.checkEnd()
+}
+
+// passes the sorted ranges contained in body, which starts at offset, to handler skipping the bytes between them
+func (h *HttpFileSource) handleRanges(offset int64, body io.Reader, ranges []ByteRange, handler RangeHandler,
+	delivered *[]ByteRange) error {
+	for _, r := range ranges {
+		_, err := io.CopyN(ioutil.Discard, body, r.Begin-offset)
+		if err != nil {
+			return &TransientError{Err: fmt.Errorf("unable to skip bytes: %s", err.Error())}
+		}
+
+		err = h.handleRange(r, io.LimitReader(body, r.Size()), handler, delivered)
+		if err != nil {
+			return err
+		}
+
+		offset = r.End
+	}
+
+	return nil
+}
+
+// calls handler recording the delivered bytes, handler errors caused by body read errors are transient. The body
+// must contain exactly the bytes of byteRange.
+func (h *HttpFileSource) handleRange(byteRange ByteRange, body io.Reader, handler RangeHandler,
+	delivered *[]ByteRange) error {
+	exactBody := &exactReader{reader: body, remaining: byteRange.Size()}
+	reader := &progressReader{source: h, byteRange: byteRange, reader: exactBody}
+	err := handler(byteRange, reader)
+	*delivered = append(*delivered, ByteRange{Begin: byteRange.Begin, End: byteRange.Begin + reader.received})
+
+	if err != nil && reader.err != nil && reader.err != io.EOF && !errors.Is(reader.err, errBodyTooLong) {
+		return &TransientError{Err: err}
+	}
+
+	if err == nil && exactBody.remaining == 0 {
+		err = exactBody.checkEnd()
+	}
+
+	return err
+}
+
+// parses a Content-Range header value and checks the remote file size
+func (h *HttpFileSource) parseContentRange(value string) (ByteRange, error) {
+	byteRange, total, err := parseContentRange(value)
+	if err != nil {
+		return byteRange, err
+	}
+
+	if total >= 0 && h.Size > 0 && total != h.Size {
+		return byteRange, fmt.Errorf("%w: \"%s\" size is %d instead of %d", ErrRemoteChanged, h.URL, total, h.Size)
+	}
+
+	return byteRange, nil
+}
+
+func (h *HttpFileSource) ctx() context.Context {
+	if h.Ctx == nil {
+		return context.Background()
+	}
+
+	return h.Ctx
+}
+
+// requests the bytes [rangeBegin, rangeEnd), the returned body fails if it doesn't contain exactly those bytes
+func (h *HttpFileSource) doRangeRequest(rangeBegin int64, rangeEnd int64) (io.ReadCloser, error) {
+	requestedRange := ByteRange{Begin: rangeBegin, End: rangeEnd}
+	if requestedRange.Size() <= 0 {
+		return nil, fmt.Errorf("invalid range: %d-%d", rangeBegin, rangeEnd)
+	}
+
+	rangedResponse, err := h.doRequest(formatRangeSpecifier([]ByteRange{requestedRange}))
+	if err != nil {
+		return nil, err
+	}
+
+	if rangedResponse.StatusCode != 206 {
+		_ = rangedResponse.Body.Close()
+		return nil, ErrRangeNotSupported
+	}
+
+	err = h.checkRangeResponse(rangedResponse, []ByteRange{requestedRange}, true)
+	if err != nil {
+		_ = rangedResponse.Body.Close()
+		return nil, err
+	}
+
+	return &exactReadCloser{
+		exactReader: exactReader{reader: rangedResponse.Body, remaining: requestedRange.Size()},
+		closer:      rangedResponse.Body,
+	}, nil
+}
+
+// checks that the single range response Content-Range and Content-Length headers match the requested ranges, see
+// receivedRanges. The received range must be exactly one of the requested ones if exact is true.
+func (h *HttpFileSource) checkRangeResponse(response *http.Response, requested []ByteRange, exact bool) error {
+	byteRange, err := h.parseContentRange(response.Header.Get("Content-Range"))
+	if err != nil {
+		return err
+	}
+
+	if response.ContentLength >= 0 && response.ContentLength != byteRange.Size() {
+		return fmt.Errorf("invalid response from \"%s\": Content-Length %d doesn't match Content-Range %s",
+			h.URL, response.ContentLength, response.Header.Get("Content-Range"))
+	}
+
+	if exact && !rangeRequested(byteRange, requested, true) || receivedRanges(byteRange, requested) == nil {
+		return fmt.Errorf("invalid response from \"%s\": unexpected Content-Range %s", h.URL,
+			response.Header.Get("Content-Range"))
+	}
+
+	return nil
+}
+
+func rangeRequested(byteRange ByteRange, requested []ByteRange, exact bool) bool {
+	for _, r := range requested {
+		if byteRange == r || (!exact && byteRange.Begin >= r.Begin && byteRange.End <= r.End) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// the parts of the requested ranges contained in a received range, sorted. Both ends of the received range must be
+// requested, it's nil otherwise.
+func receivedRanges(byteRange ByteRange, requested []ByteRange) []ByteRange {
+	first := ByteRange{Begin: byteRange.Begin, End: byteRange.Begin + 1}
+	last := ByteRange{Begin: byteRange.End - 1, End: byteRange.End}
+	if !rangeRequested(first, requested, false) || !rangeRequested(last, requested, false) {
+		return nil
+	}
+
+	var received []ByteRange
+	for _, r := range requested {
+		if r.Begin >= byteRange.End || r.End <= byteRange.Begin {
+			continue
+		}
+
+		if r.Begin < byteRange.Begin {
+			r.Begin = byteRange.Begin
+		}
+		if r.End > byteRange.End {
+			r.End = byteRange.End
+		}
+		received = append(received, r)
+	}
+
+	sort.Slice(received, func(i, j int) bool {
+		return received[i].Begin < received[j].Begin
+	})
+	return received
+}
+
+// performs a GET request with the given Range header value, the whole file is requested if rangeSpecifier is empty
+func (h *HttpFileSource) doRequest(rangeSpecifier string) (*http.Response, error) {
+	rangedRequest, err := http.NewRequestWithContext(h.ctx(), "GET", h.URL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating range request for \"%v\": %v", h.URL, err)
 	}
 
-	rangeSpecifier := fmt.Sprintf("bytes=%v-%v", range_start, range_end)
 	rangedRequest.ProtoAtLeast(1, 1)
-	rangedRequest.Header.Add("Range", rangeSpecifier)
 	rangedRequest.Header.Add("Accept-Encoding", "identity")
 
-	client := &http.Client{}
-	rangedResponse, err := client.Do(rangedRequest)
+	if h.Validator == nil {
+		h.Validator = NewRemoteValidator()
+	}
+
+	if rangeSpecifier != "" {
+		rangedRequest.Header.Add("Range", rangeSpecifier)
+		if ifRange := h.Validator.ifRange(h.URL); ifRange != "" {
+			rangedRequest.Header.Add("If-Range", ifRange)
+		}
+	}
+
+	h.Stats.addRequest()
+	rangedResponse, err := h.HttpClient.Do(rangedRequest)
 	if err != nil {
-		return nil, fmt.Errorf("Error executing request for \"%v\": %v", h.URL, err)
+		return nil, &TransientError{Err: fmt.Errorf("Error executing request for \"%v\": %w", h.URL, err)}
 	}
 
-	if rangedResponse.StatusCode == 404 {
-		return nil, fmt.Errorf("URL not found")
+	rangedResponse.Body = h.Stats.countBody(rangedResponse.Body)
+
+	if rangedResponse.StatusCode >= 400 {
+		_ = rangedResponse.Body.Close()
+		return nil, newHttpStatusError(rangedResponse)
 	}
 
-	if rangedResponse.StatusCode != 206 {
-		return nil, fmt.Errorf("ranged request not supported")
+	err = h.Validator.check(h.URL, rangedResponse)
+	if err != nil {
+		_ = rangedResponse.Body.Close()
+		return nil, err
 	}
 
 	if strings.Contains(rangedResponse.Header.Get("Content-Encoding"), "gzip") {
+		_ = rangedResponse.Body.Close()
 		return nil, fmt.Errorf("response from server was GZiped")
 	}
 
-	return rangedResponse.Body, nil
+	return rangedResponse, nil
+}
+
+// reports the reads progress to OnProgress and keeps the last read error
+type progressReader struct {
+	source    *HttpFileSource
+	byteRange ByteRange
+	received  int64
+	reader    io.Reader
+	err       error
+}
+
+func (p *progressReader) Read(b []byte) (n int, err error) {
+	n, err = p.reader.Read(b)
+	p.received += int64(n)
+	p.err = err
+	if n > 0 && p.source.OnProgress != nil {
+		p.source.OnProgress(p.byteRange.Begin, p.byteRange.End, p.received)
+	}
+
+	return n, err
+}
+
+// exactReader fails if the underlying reader doesn't contain exactly remaining bytes
+type exactReader struct {
+	reader    io.Reader
+	remaining int64
+	eof       bool
+}
+
+func (e *exactReader) Read(b []byte) (n int, err error) {
+	if e.remaining <= 0 {
+		err = e.checkEnd()
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, err
+	}
+
+	if int64(len(b)) > e.remaining {
+		b = b[:e.remaining]
+	}
+
+	n, err = e.reader.Read(b)
+	e.remaining -= int64(n)
+	if err == io.EOF {
+		e.eof = true
+		if e.remaining > 0 {
+			err = fmt.Errorf("response body truncated, %d bytes missing: %w", e.remaining, io.ErrUnexpectedEOF)
+		}
+	}
+
+	return n, err
+}
+
+// returns errBodyTooLong if the underlying reader has more data once remaining bytes were read
+func (e *exactReader) checkEnd() error {
+	if e.eof {
+		return nil
+	}
+
+	var probe [1]byte
+	n, err := io.ReadFull(e.reader, probe[:])
+	if n > 0 {
+		return errBodyTooLong
+	}
+
+	// other errors don't matter, the expected bytes were already received
+	e.eof = err == io.EOF
+	return nil
+}
+
+type exactReadCloser struct {
+	exactReader
+	closer io.Closer
+}
+
+func (e *exactReadCloser) Close() error {
+	return e.closer.Close()
 }
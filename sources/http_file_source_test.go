@@ -0,0 +1,172 @@
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpFileSource_StreamRanges(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	server := &flakyServer{content: content, fail: func(request int, w http.ResponseWriter, r *http.Request) bool {
+		// ranges are ignored
+		_, _ = w.Write(content)
+		return true
+	}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	source := &HttpFileSource{URL: ts.URL, Size: int64(len(content))}
+	_, err := readAll(source, []ByteRange{{Begin: 2, End: 4}})
+	assert.Equal(t, ErrRangeNotSupported, err)
+
+	received := map[ByteRange]string{}
+	err = source.StreamRanges([]ByteRange{{Begin: 2, End: 4}, {Begin: 10, End: 15}},
+		func(byteRange ByteRange, body io.Reader) error {
+			data, err := ioutil.ReadAll(body)
+			received[byteRange] = string(data)
+			return err
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[ByteRange]string{{Begin: 2, End: 4}: "23", {Begin: 10, End: 15}: "abcde"}, received)
+	assert.Equal(t, []string{"bytes=2-3", ""}, server.ranges)
+}
+
+func TestHttpFileSource_RequestInclusiveEnd(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	server := &flakyServer{content: content}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	source := &HttpFileSource{URL: ts.URL, Size: int64(len(content))}
+	var output strings.Builder
+
+	_, _ = source.Seek(2, io.SeekStart)
+	_, err := io.CopyN(&output, source, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "2345", output.String())
+
+	// requests past the end of the file are trimmed
+	output.Reset()
+	_, _ = source.Seek(18, io.SeekStart)
+	n, err := io.Copy(&output, source)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, "ij", output.String())
+
+	assert.Equal(t, []string{"bytes=2-5", "bytes=18-19"}, server.ranges)
+}
+
+func TestHttpFileSource_ReadRangesMerged(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	ranges := []ByteRange{{Begin: 0, End: 2}, {Begin: 3, End: 5}, {Begin: 10, End: 12}}
+	tests := []struct {
+		name     string
+		response func(w http.ResponseWriter, r *http.Request)
+	}{
+		{"single part", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-11/%d", len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[0:12])
+		}},
+		{"multipart", func(w http.ResponseWriter, r *http.Request) {
+			parts := multipart.NewWriter(w)
+			w.Header().Set("Content-Type", "multipart/byteranges; boundary="+parts.Boundary())
+			w.WriteHeader(http.StatusPartialContent)
+			for _, byteRange := range []ByteRange{{Begin: 0, End: 5}, {Begin: 10, End: 12}} {
+				part, _ := parts.CreatePart(textproto.MIMEHeader{"Content-Range": {
+					fmt.Sprintf("bytes %d-%d/%d", byteRange.Begin, byteRange.End-1, len(content))}})
+				_, _ = part.Write(content[byteRange.Begin:byteRange.End])
+			}
+			_ = parts.Close()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				tt.response(w, r)
+			}))
+			defer ts.Close()
+
+			// the server merges the requested ranges, the bytes between them are skipped
+			received := map[ByteRange]string{}
+			source := &HttpFileSource{URL: ts.URL, Size: int64(len(content))}
+			err := source.ReadRanges(ranges, func(byteRange ByteRange, body io.Reader) error {
+				data, err := ioutil.ReadAll(body)
+				received[byteRange] = string(data)
+				return err
+			})
+
+			assert.Nil(t, err)
+			assert.Equal(t, map[ByteRange]string{{Begin: 0, End: 2}: "01", {Begin: 3, End: 5}: "34",
+				{Begin: 10, End: 12}: "ab"}, received)
+			assert.Equal(t, 1, requests)
+		})
+	}
+}
+
+func TestHttpFileSource_InvalidResponseLength(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	tests := []struct {
+		name     string
+		response func(w http.ResponseWriter, r *http.Request)
+		expected func(err error) bool
+	}{
+		{"wrong Content-Range", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-9/%d", len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[:10])
+		}, func(err error) bool { return strings.Contains(err.Error(), "unexpected Content-Range") }},
+		{"Content-Length mismatch", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 2-5/%d", len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[2:8])
+		}, func(err error) bool { return strings.Contains(err.Error(), "Content-Length") }},
+		{"oversized body", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 2-5/%d", len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			// without Content-Length
+			w.(http.Flusher).Flush()
+			_, _ = w.Write(content[2:8])
+		}, func(err error) bool { return errors.Is(err, errBodyTooLong) }},
+		{"truncated body", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 2-5/%d", len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.(http.Flusher).Flush()
+			_, _ = w.Write(content[2:4])
+		}, func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(tt.response))
+			defer ts.Close()
+
+			source := &HttpFileSource{URL: ts.URL, Size: int64(len(content))}
+			_, err := readAll(source, []ByteRange{{Begin: 2, End: 6}})
+			assert.True(t, err != nil && tt.expected(err), err)
+
+			if tt.name == "oversized body" {
+				// the legacy reader never reads past the requested bytes
+				return
+			}
+
+			_, _ = source.Seek(2, io.SeekStart)
+			_, err = io.Copy(ioutil.Discard, io.LimitReader(source, 4))
+			assert.True(t, err != nil && tt.expected(err), err)
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MirroredHttpFileSource reads a file hosted in several mirrors. Requests are spread across the healthy mirrors and
+// when one fails the next mirror is tried.
+type MirroredHttpFileSource struct {
+	Offset int64
+	Size   int64
+	// requests are aborted once Ctx is done, context.Background() is used if nil
+	Ctx context.Context
+	// optional, called after every read
+	OnProgress ProgressFunc
+	// optional, limits the concurrent ReadRanges requests per host
+	Limiter *ConnectionLimiter
+	// optional, checks that all the mirrors responses belong to the same version of their file
+	Validator *RemoteValidator
+	// optional, sends the requests
+	HttpClient *HttpClient
+	// optional, failed ReadRanges requests are retried on the same mirror before trying the next one
+	RetryPolicy *RetryPolicy
+	// optional, counts the requests and the received bytes of all the mirrors
+	Stats *TransferStats
+
+	mirrors []*HttpFileSource
+	failed  []error
+	next    int
+	current *HttpFileSource
+}
+
+func NewMirroredHttpFileSource(urls []string, size int64) *MirroredHttpFileSource {
+	source := &MirroredHttpFileSource{Size: size, failed: make([]error, len(urls))}
+	for _, url := range urls {
+		source.mirrors = append(source.mirrors, &HttpFileSource{URL: url, Size: size})
+	}
+
+	return source
+}
+
+func (m *MirroredHttpFileSource) Read(b []byte) (n int, err error) {
+	if m.current == nil {
+		err = m.Request(int64(len(b)))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = m.current.Read(b)
+	m.Offset = m.current.Offset
+	return n, err
+}
+
+func (m *MirroredHttpFileSource) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case 0:
+		m.Offset = offset
+	case 1:
+		m.Offset += offset
+	case 2:
+		m.Offset = m.Size + offset
+	default:
+		return -1, fmt.Errorf("Unknown whence value: %d", whence)
+	}
+
+	if m.current != nil {
+		m.current.Offset = m.Offset
+	}
+
+	return m.Offset, nil
+}
+
+// Request the next size bytes from the next healthy mirror, mirrors that fail are not used again
+func (m *MirroredHttpFileSource) Request(size int64) error {
+	mirror, err := m.tryMirrors(func(mirror *HttpFileSource) (bool, error) {
+		mirror.Offset = m.Offset
+		return true, mirror.Request(size)
+	})
+
+	m.current = mirror
+	return err
+}
+
+// ReadRanges reads the ranges from the next healthy mirror. The next mirror is tried if the request fails before
+// handler is called.
+func (m *MirroredHttpFileSource) ReadRanges(ranges []ByteRange, handler RangeHandler) error {
+	_, err := m.tryMirrors(func(mirror *HttpFileSource) (bool, error) {
+		handled := false
+		err := mirror.ReadRanges(ranges, func(byteRange ByteRange, body io.Reader) error {
+			handled = true
+			return handler(byteRange, body)
+		})
+
+		return !handled, err
+	})
+
+	return err
+}
+
+// StreamRanges streams the whole file from the next healthy mirror passing the ranges to handler, see
+// HttpFileSource.StreamRanges. The next mirror is tried if the request fails before handler is called.
+func (m *MirroredHttpFileSource) StreamRanges(ranges []ByteRange, handler RangeHandler) error {
+	_, err := m.tryMirrors(func(mirror *HttpFileSource) (bool, error) {
+		handled := false
+		err := mirror.StreamRanges(ranges, func(byteRange ByteRange, body io.Reader) error {
+			handled = true
+			return handler(byteRange, body)
+		})
+
+		return !handled, err
+	})
+
+	return err
+}
+
+// runs request on the healthy mirrors, starting from the next one, until it succeeds or it can't be retried
+func (m *MirroredHttpFileSource) tryMirrors(request func(mirror *HttpFileSource) (retry bool, err error)) (
+	*HttpFileSource, error) {
+	for i := 0; i < len(m.mirrors); i++ {
+		idx := (m.next + i) % len(m.mirrors)
+		if m.failed[idx] != nil {
+			continue
+		}
+
+		mirror := m.mirrors[idx]
+		mirror.Ctx = m.Ctx
+		mirror.OnProgress = m.OnProgress
+		mirror.Limiter = m.Limiter
+		mirror.Validator = m.Validator
+		mirror.HttpClient = m.HttpClient
+		mirror.RetryPolicy = m.RetryPolicy
+		mirror.Stats = m.Stats
+		retry, err := request(mirror)
+		if err == nil {
+			m.next = idx + 1
+			return mirror, nil
+		}
+
+		if m.Ctx != nil && m.Ctx.Err() != nil {
+			// the mirror isn't to blame
+			return nil, m.Ctx.Err()
+		}
+
+		// a changed remote file means the control file is outdated, the other mirrors won't help
+		if !retry || errors.Is(err, ErrRemoteChanged) {
+			return nil, err
+		}
+
+		m.failed[idx] = err
+	}
+
+	return nil, &mirrorsFailedError{summary: m.failureSummary(), failures: m.failed}
+}
+
+// mirrorsFailedError matches the errors of every mirror with errors.Is and errors.As
+type mirrorsFailedError struct {
+	summary  string
+	failures []error
+}
+
+func (e *mirrorsFailedError) Error() string {
+	return "all mirrors failed: " + e.summary
+}
+
+func (e *mirrorsFailedError) Is(target error) bool {
+	for _, err := range e.failures {
+		if err != nil && errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *mirrorsFailedError) As(target interface{}) bool {
+	for _, err := range e.failures {
+		if err != nil && errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HealthyMirrors returns the urls of the mirrors that haven't failed
+func (m *MirroredHttpFileSource) HealthyMirrors() []string {
+	var urls []string
+	for i, mirror := range m.mirrors {
+		if m.failed[i] == nil {
+			urls = append(urls, mirror.URL)
+		}
+	}
+
+	return urls
+}
+
+func (m *MirroredHttpFileSource) failureSummary() string {
+	var failures []string
+	for i, mirror := range m.mirrors {
+		if m.failed[i] != nil {
+			failures = append(failures, mirror.URL+": "+m.failed[i].Error())
+		}
+	}
+
+	if len(failures) == 0 {
+		return "no mirrors available"
+	}
+
+	return strings.Join(failures, ", ")
+}
@@ -0,0 +1,69 @@
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrRemoteChanged is returned when the remote file is replaced while it's being read
+var ErrRemoteChanged = errors.New("remote changed")
+
+// RemoteValidator remembers the ETag and Last-Modified values of the first response received from each URL and
+// checks that the later responses belong to the same version of the file, it can be shared by several sources
+type RemoteValidator struct {
+	mutex      sync.Mutex
+	validators map[string]remoteVersion
+}
+
+type remoteVersion struct {
+	etag         string
+	lastModified string
+}
+
+func NewRemoteValidator() *RemoteValidator {
+	return &RemoteValidator{validators: make(map[string]remoteVersion)}
+}
+
+// returns the If-Range header value for url, empty if there is no validator yet
+func (v *RemoteValidator) ifRange(url string) string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	version := v.validators[url]
+	// weak ETags can't be used in If-Range
+	if version.etag != "" && !strings.HasPrefix(version.etag, "W/") {
+		return version.etag
+	}
+
+	return version.lastModified
+}
+
+// compares the response validators with the ones of the first response received from url
+func (v *RemoteValidator) check(url string, response *http.Response) error {
+	received := remoteVersion{
+		etag:         response.Header.Get("ETag"),
+		lastModified: response.Header.Get("Last-Modified"),
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	expected, ok := v.validators[url]
+	if !ok {
+		v.validators[url] = received
+		return nil
+	}
+
+	if expected.etag != "" && received.etag != "" && expected.etag != received.etag {
+		return fmt.Errorf("%w: \"%s\" ETag changed from %s to %s", ErrRemoteChanged, url, expected.etag, received.etag)
+	}
+
+	if expected.lastModified != "" && received.lastModified != "" && expected.lastModified != received.lastModified {
+		return fmt.Errorf("%w: \"%s\" modified on %s", ErrRemoteChanged, url, received.lastModified)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package sources
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newValidatedResponse(etag string, lastModified string) *http.Response {
+	response := &http.Response{Header: http.Header{}}
+	if etag != "" {
+		response.Header.Set("ETag", etag)
+	}
+
+	if lastModified != "" {
+		response.Header.Set("Last-Modified", lastModified)
+	}
+
+	return response
+}
+
+func TestRemoteValidator(t *testing.T) {
+	validator := NewRemoteValidator()
+	assert.Equal(t, "", validator.ifRange("a"))
+
+	assert.Nil(t, validator.check("a", newValidatedResponse("\"v1\"", "Mon, 01 Feb 2021 00:00:00 GMT")))
+	assert.Equal(t, "\"v1\"", validator.ifRange("a"))
+
+	assert.Nil(t, validator.check("a", newValidatedResponse("\"v1\"", "")))
+	err := validator.check("a", newValidatedResponse("\"v2\"", ""))
+	assert.True(t, errors.Is(err, ErrRemoteChanged))
+	err = validator.check("a", newValidatedResponse("", "Tue, 02 Feb 2021 00:00:00 GMT"))
+	assert.True(t, errors.Is(err, ErrRemoteChanged))
+
+	// every url has its own validators
+	assert.Nil(t, validator.check("b", newValidatedResponse("W/\"v1\"", "Mon, 01 Feb 2021 00:00:00 GMT")))
+	assert.Equal(t, "Mon, 01 Feb 2021 00:00:00 GMT", validator.ifRange("b"))
+}
+
+func TestHttpFileSource_ReadRangesChangedSize(t *testing.T) {
+	content := []byte("0123456789")
+	ts := httptest.NewServer(&flakyServer{content: content})
+	defer ts.Close()
+
+	source := &HttpFileSource{URL: ts.URL, Size: 20}
+	_, err := readAll(source, []ByteRange{{Begin: 0, End: 5}})
+	assert.True(t, errors.Is(err, ErrRemoteChanged))
+}
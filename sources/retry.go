@@ -0,0 +1,171 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy defines how failed requests are retried, the delay between attempts grows exponentially and is
+// randomized to avoid synchronized retries
+type RetryPolicy struct {
+	// consecutive failed attempts allowed, attempts that receive data reset the count
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 5, InitialBackoff: 500 * time.Millisecond, MaxBackoff: 30 * time.Second}
+
+// HttpStatusError is returned when the server answers with an error status
+type HttpStatusError struct {
+	URL        string
+	StatusCode int
+	// delay requested by the server through the Retry-After header
+	RetryAfter time.Duration
+}
+
+func (e *HttpStatusError) Error() string {
+	if e.StatusCode == http.StatusNotFound {
+		return "URL not found"
+	}
+
+	return fmt.Sprintf("unexpected response from \"%s\": %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Permanent reports whether retrying the request is pointless
+func (e *HttpStatusError) Permanent() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+
+	return e.StatusCode < 500
+}
+
+func newHttpStatusError(response *http.Response) *HttpStatusError {
+	return &HttpStatusError{
+		URL:        response.Request.URL.String(),
+		StatusCode: response.StatusCode,
+		RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+	}
+}
+
+// TransientError wraps connection errors, they can be retried
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether the request that caused err can be retried
+func IsRetryable(err error) bool {
+	var statusErr *HttpStatusError
+	if errors.As(err, &statusErr) {
+		return !statusErr.Permanent()
+	}
+
+	var transientErr *TransientError
+	return errors.As(err, &transientErr)
+}
+
+// returns the delay before the next attempt or false if the request must not be retried
+func (p *RetryPolicy) nextDelay(err error, failures int) (time.Duration, bool) {
+	if p == nil || failures > p.MaxRetries || !IsRetryable(err) {
+		return 0, false
+	}
+
+	// a MaxBackoff of 0 doesn't limit the backoff, it stops doubling before overflowing
+	backoff := p.InitialBackoff
+	for i := 1; i < failures && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff) && backoff < math.MaxInt64/2; i++ {
+		backoff *= 2
+	}
+
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	// jitter in [backoff/2, backoff)
+	if backoff > 1 {
+		backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)))
+	}
+
+	var statusErr *HttpStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > backoff {
+		backoff = statusErr.RetryAfter
+	}
+
+	return backoff, true
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parses the Retry-After header, both the delay-seconds and the HTTP-date formats are supported
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
+}
+
+// returns the parts of ranges not covered by the delivered ranges
+func subtractRanges(ranges []ByteRange, delivered []ByteRange) []ByteRange {
+	result := ranges
+	for _, d := range delivered {
+		if d.Size() <= 0 {
+			continue
+		}
+
+		var next []ByteRange
+		for _, r := range result {
+			if d.End <= r.Begin || d.Begin >= r.End {
+				next = append(next, r)
+				continue
+			}
+
+			if r.Begin < d.Begin {
+				next = append(next, ByteRange{Begin: r.Begin, End: d.Begin})
+			}
+
+			if d.End < r.End {
+				next = append(next, ByteRange{Begin: d.End, End: r.End})
+			}
+		}
+
+		result = next
+	}
+
+	return result
+}
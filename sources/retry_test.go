@@ -0,0 +1,249 @@
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testRetryPolicy = &RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+func TestSubtractRanges(t *testing.T) {
+	ranges := []ByteRange{{Begin: 0, End: 10}, {Begin: 20, End: 30}}
+
+	assert.Equal(t, ranges, subtractRanges(ranges, nil))
+	assert.Equal(t, []ByteRange{{Begin: 5, End: 10}, {Begin: 20, End: 30}},
+		subtractRanges(ranges, []ByteRange{{Begin: 0, End: 5}}))
+	assert.Equal(t, []ByteRange{{Begin: 25, End: 30}},
+		subtractRanges(ranges, []ByteRange{{Begin: 0, End: 10}, {Begin: 20, End: 25}}))
+	assert.Equal(t, []ByteRange{{Begin: 0, End: 2}, {Begin: 8, End: 10}, {Begin: 20, End: 30}},
+		subtractRanges(ranges, []ByteRange{{Begin: 2, End: 8}}))
+	assert.Nil(t, subtractRanges(ranges, []ByteRange{{Begin: 0, End: 30}}))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+
+	delay := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, delay > 50*time.Second && delay <= time.Minute)
+}
+
+func TestHttpStatusError_Permanent(t *testing.T) {
+	for _, status := range []int{400, 403, 404, 416} {
+		assert.True(t, (&HttpStatusError{StatusCode: status}).Permanent(), status)
+	}
+
+	for _, status := range []int{408, 429, 500, 502, 503} {
+		assert.False(t, (&HttpStatusError{StatusCode: status}).Permanent(), status)
+	}
+
+	assert.False(t, IsRetryable(fmt.Errorf("unexpected")))
+	assert.True(t, IsRetryable(fmt.Errorf("wrapped: %w", &TransientError{Err: fmt.Errorf("reset")})))
+}
+
+func TestRetryPolicy_NextDelay(t *testing.T) {
+	err := &HttpStatusError{StatusCode: 503}
+	for failures := 1; failures <= testRetryPolicy.MaxRetries; failures++ {
+		delay, retry := testRetryPolicy.nextDelay(err, failures)
+		assert.True(t, retry)
+		assert.True(t, delay <= testRetryPolicy.MaxBackoff)
+	}
+
+	// the jitter keeps each delay below the shortest next one
+	unlimited := &RetryPolicy{MaxRetries: 5, InitialBackoff: time.Second}
+	var previous time.Duration
+	for failures := 1; failures <= unlimited.MaxRetries; failures++ {
+		delay, retry := unlimited.nextDelay(err, failures)
+		assert.True(t, retry)
+		assert.True(t, delay > previous, "attempt %d: %s after %s", failures, delay, previous)
+		previous = delay
+	}
+	assert.True(t, previous >= 8*time.Second)
+
+	_, retry := testRetryPolicy.nextDelay(err, testRetryPolicy.MaxRetries+1)
+	assert.False(t, retry)
+
+	delay, _ := testRetryPolicy.nextDelay(&HttpStatusError{StatusCode: 429, RetryAfter: time.Second}, 1)
+	assert.Equal(t, time.Second, delay)
+
+	var noPolicy *RetryPolicy
+	_, retry = noPolicy.nextDelay(err, 1)
+	assert.False(t, retry)
+}
+
+// serves content, the handler may write a response itself and return true
+type flakyServer struct {
+	content []byte
+	fail    func(request int, w http.ResponseWriter, r *http.Request) bool
+
+	mutex  sync.Mutex
+	ranges []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	request := len(s.ranges)
+	s.mutex.Unlock()
+
+	if s.fail != nil && s.fail(request, w, r) {
+		return
+	}
+
+	var begin, last int64
+	_, _ = fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &begin, &last)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", begin, last, len(s.content)))
+	w.WriteHeader(http.StatusPartialContent)
+	_, _ = w.Write(s.content[begin : last+1])
+}
+
+func readAll(source *HttpFileSource, ranges []ByteRange) ([]byte, error) {
+	var data []byte
+	err := source.ReadRanges(ranges, func(byteRange ByteRange, body io.Reader) error {
+		b, err := ioutil.ReadAll(body)
+		data = append(data, b...)
+		return err
+	})
+
+	return data, err
+}
+
+func TestHttpFileSource_ReadRangesResumesInterruptedBody(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	server := &flakyServer{content: content, fail: func(request int, w http.ResponseWriter, r *http.Request) bool {
+		if request > 1 {
+			return false
+		}
+
+		// announce the whole range but drop the connection after 5 bytes
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-19/%d", len(content)))
+		w.Header().Set("Content-Length", "20")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content[:5])
+		w.(http.Flusher).Flush()
+
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		_ = conn.Close()
+		return true
+	}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	source := &HttpFileSource{URL: ts.URL, Size: int64(len(content)), RetryPolicy: testRetryPolicy}
+	data, err := readAll(source, []ByteRange{{Begin: 0, End: 20}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, content, data)
+	assert.Equal(t, []string{"bytes=0-19", "bytes=5-19"}, server.ranges)
+}
+
+func TestHttpFileSource_ReadRangesRequestsMissingParts(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	server := &flakyServer{content: content, fail: func(request int, w http.ResponseWriter, r *http.Request) bool {
+		if request > 1 {
+			return false
+		}
+
+		// only the first of the requested ranges is sent
+		parts := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/byteranges; boundary="+parts.Boundary())
+		w.WriteHeader(http.StatusPartialContent)
+		part, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Range": {fmt.Sprintf("bytes 0-3/%d", len(content))},
+		})
+		_, _ = part.Write(content[0:4])
+		_ = parts.Close()
+		return true
+	}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	// without RetryPolicy
+	source := &HttpFileSource{URL: ts.URL, Size: int64(len(content))}
+	data, err := readAll(source, []ByteRange{{Begin: 0, End: 4}, {Begin: 10, End: 15}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("0123abcde"), data)
+	assert.Equal(t, []string{"bytes=0-3,10-14", "bytes=10-14"}, server.ranges)
+}
+
+func TestHttpFileSource_ReadRangesEmptyResponse(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	server := &flakyServer{content: content, fail: func(request int, w http.ResponseWriter, r *http.Request) bool {
+		if request > 1 {
+			return false
+		}
+
+		// none of the requested ranges is sent
+		parts := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/byteranges; boundary="+parts.Boundary())
+		w.WriteHeader(http.StatusPartialContent)
+		_ = parts.Close()
+		return true
+	}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	ranges := []ByteRange{{Begin: 0, End: 4}, {Begin: 10, End: 15}}
+	source := &HttpFileSource{URL: ts.URL, Size: int64(len(content))}
+	_, err := readAll(source, ranges)
+	assert.True(t, IsRetryable(err), err)
+
+	server.ranges = nil
+	source.RetryPolicy = testRetryPolicy
+	data, err := readAll(source, ranges)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("0123abcde"), data)
+}
+
+func TestHttpFileSource_ReadRangesRetriesServerErrors(t *testing.T) {
+	content := []byte("0123456789")
+	server := &flakyServer{content: content, fail: func(request int, w http.ResponseWriter, r *http.Request) bool {
+		if request > 2 {
+			return false
+		}
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return true
+	}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	source := &HttpFileSource{URL: ts.URL, Size: int64(len(content)), RetryPolicy: testRetryPolicy}
+	data, err := readAll(source, []ByteRange{{Begin: 2, End: 6}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, content[2:6], data)
+	assert.Len(t, server.ranges, 3)
+}
+
+func TestHttpFileSource_ReadRangesDoesNotRetryPermanentErrors(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable} {
+		server := &flakyServer{fail: func(request int, w http.ResponseWriter, r *http.Request) bool {
+			w.WriteHeader(status)
+			return true
+		}}
+		ts := httptest.NewServer(server)
+
+		source := &HttpFileSource{URL: ts.URL, Size: 10, RetryPolicy: testRetryPolicy}
+		_, err := readAll(source, []ByteRange{{Begin: 0, End: 10}})
+		ts.Close()
+
+		var statusErr *HttpStatusError
+		assert.True(t, errors.As(err, &statusErr))
+		assert.Equal(t, status, statusErr.StatusCode)
+		assert.Len(t, server.ranges, 1)
+	}
+}
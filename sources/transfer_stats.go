@@ -0,0 +1,57 @@
+package sources
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// TransferStats counts the requests sent and the response body bytes received. It can be shared by concurrent
+// sources, a nil *TransferStats counts nothing.
+type TransferStats struct {
+	requests      int64
+	receivedBytes int64
+}
+
+// Requests returns the number of requests sent, including the failed and retried ones
+func (s *TransferStats) Requests() int {
+	if s == nil {
+		return 0
+	}
+
+	return int(atomic.LoadInt64(&s.requests))
+}
+
+// ReceivedBytes returns the response body bytes received, including multipart headers and discarded data
+func (s *TransferStats) ReceivedBytes() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&s.receivedBytes)
+}
+
+func (s *TransferStats) addRequest() {
+	if s != nil {
+		atomic.AddInt64(&s.requests, 1)
+	}
+}
+
+// wraps body to count the bytes read from it
+func (s *TransferStats) countBody(body io.ReadCloser) io.ReadCloser {
+	if s == nil {
+		return body
+	}
+
+	return &countingReadCloser{ReadCloser: body, stats: s}
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	stats *TransferStats
+}
+
+func (c *countingReadCloser) Read(b []byte) (n int, err error) {
+	n, err = c.ReadCloser.Read(b)
+	atomic.AddInt64(&c.stats.receivedBytes, int64(n))
+	return n, err
+}
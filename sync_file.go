@@ -0,0 +1,210 @@
+package zsync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/AppImageCrafters/libzsync-go/chunks"
+	"github.com/AppImageCrafters/libzsync-go/chunksmapper"
+)
+
+// PartialSuffix is appended to the SyncToFile destination to name the file being written
+const PartialSuffix = ".part"
+
+// BackupSuffix is appended to the SyncToFile destination to name the backup of the replaced file
+const BackupSuffix = ".zs-old"
+
+// SyncToFile writes the remote file to destPath reusing the chunks found at seedPath. The data is written to
+// <destPath>.part, which replaces destPath once its checksum is verified. The output gets the permissions of the
+// seed and MTime as modification time.
+//
+// An interrupted sync leaves <destPath>.part in place. The blocks of that file that match the control file are
+// reused by the next sync, so only the ranges still missing are downloaded.
+func (zsync *ZSync) SyncToFile(seedPath string, destPath string) (SyncTotals, error) {
+	return zsync.SyncToFileContext(context.Background(), seedPath, destPath)
+}
+
+// SyncToFileContext is like SyncToFile but it stops scanning the seed and downloading chunks once ctx is done,
+// ctx.Err() is returned in such case.
+func (zsync *ZSync) SyncToFileContext(ctx context.Context, seedPath string, destPath string) (SyncTotals, error) {
+	return zsync.SyncSeedsToFileContext(ctx, []string{seedPath}, destPath)
+}
+
+// SyncSeedsToFileContext is like SyncToFileContext but the chunks are searched in several seeds, the output gets the
+// permissions of the first one.
+func (zsync *ZSync) SyncSeedsToFileContext(ctx context.Context, seedPaths []string, destPath string) (SyncTotals,
+	error) {
+	seeds, closeSeeds, err := openSeeds(seedPaths)
+	if err != nil {
+		return SyncTotals{}, err
+	}
+	defer closeSeeds()
+
+	partPath := destPath + PartialSuffix
+	output, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return SyncTotals{}, fmt.Errorf("unable to create %s: %w", partPath, err)
+	}
+
+	totals, err := zsync.syncPartialFile(ctx, seeds, output)
+	if err != nil {
+		_ = output.Close()
+		return totals, err
+	}
+
+	err = zsync.finishPartialFile(output, seedPaths, destPath)
+	closeErr := output.Close()
+	if err != nil {
+		return totals, err
+	}
+
+	if closeErr != nil {
+		return totals, fmt.Errorf("unable to write %s: %w", partPath, closeErr)
+	}
+
+	return totals, zsync.replaceDestination(partPath, destPath)
+}
+
+// moves the output in place of destPath
+func (zsync *ZSync) replaceDestination(partPath string, destPath string) error {
+	if !zsync.MTime.IsZero() {
+		err := os.Chtimes(partPath, zsync.MTime, zsync.MTime)
+		if err != nil {
+			return fmt.Errorf("unable to set the modification time of %s: %w", partPath, err)
+		}
+	}
+
+	if zsync.KeepBackup {
+		err := backupFile(destPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := os.Rename(partPath, destPath)
+	if err != nil {
+		return fmt.Errorf("unable to move %s in place: %w", partPath, err)
+	}
+
+	syncDir(filepath.Dir(destPath))
+	return nil
+}
+
+// writes the remote file into output reusing the blocks it already holds
+func (zsync *ZSync) syncPartialFile(ctx context.Context, seeds []Seed, output *os.File) (SyncTotals, error) {
+	stat, err := output.Stat()
+	if err != nil {
+		return SyncTotals{}, err
+	}
+
+	// the data past the end belongs to a longer version of the remote file
+	partialSize := stat.Size()
+	if partialSize > zsync.RemoteFileSize {
+		partialSize = zsync.RemoteFileSize
+	}
+
+	partial := NewSeed(output.Name(), output, partialSize)
+	plan, err := zsync.plan(ctx, &partial, seeds)
+	if err != nil {
+		return SyncTotals{}, err
+	}
+
+	if stat.Size() > zsync.RemoteFileSize {
+		err = output.Truncate(zsync.RemoteFileSize)
+		if err != nil {
+			return SyncTotals{}, err
+		}
+	}
+
+	return zsync.ExecuteContext(ctx, plan, output)
+}
+
+// Adds the blocks of a partial output that are already in place, each one is verified against the checksums index.
+// They are copied onto themselves, therefore writing the output doesn't overwrite the data of other chunks.
+func (zsync *ZSync) mapPartialChunks(ctx context.Context, source *io.SectionReader,
+	chunkMapper *chunksmapper.ChunksMapper) error {
+	for offset := int64(0); offset < source.Size(); offset += zsync.BlockSize {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		weakSum, strongSum := zsync.readBlockChecksums(source, offset)
+		if !zsync.ChecksumsIndex.MatchesBlock(uint(offset/zsync.BlockSize), weakSum, strongSum) {
+			continue
+		}
+
+		chunk := chunks.ChunkInfo{Size: zsync.BlockSize, Source: source, SourceOffset: offset, TargetOffset: offset}
+		if chunk.TargetOffset+chunk.Size > zsync.RemoteFileSize {
+			chunk.Size = zsync.RemoteFileSize - chunk.TargetOffset
+		}
+
+		chunkMapper.Add(chunk)
+		zsync.notifyChunkMatched(chunk)
+	}
+
+	return nil
+}
+
+// flushes the verified output to disk and copies the permissions of the first seed or the destination
+func (zsync *ZSync) finishPartialFile(output *os.File, seedPaths []string, destPath string) error {
+	err := output.Sync()
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %w", output.Name(), err)
+	}
+
+	candidates := append(append([]string{}, seedPaths...), destPath)
+	for _, path := range candidates {
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		err = output.Chmod(stat.Mode().Perm())
+		if err != nil {
+			return fmt.Errorf("unable to set the permissions of %s: %w", output.Name(), err)
+		}
+
+		break
+	}
+
+	return nil
+}
+
+// Keeps path as <path>.zs-old. A hard link is used so path never goes missing, it's renamed if the file system
+// doesn't support them.
+func backupFile(path string) error {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	backupPath := path + BackupSuffix
+	err := os.Remove(backupPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to backup %s: %w", path, err)
+	}
+
+	if os.Link(path, backupPath) == nil {
+		return nil
+	}
+
+	err = os.Rename(path, backupPath)
+	if err != nil {
+		return fmt.Errorf("unable to backup %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// persists the renames done in dir, not every platform supports it so errors are ignored
+func syncDir(dir string) {
+	file, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+
+	_ = file.Sync()
+	_ = file.Close()
+}
@@ -0,0 +1,134 @@
+package updateinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AppImageCrafters/libzsync-go/sources"
+)
+
+// Asset is a file published in a release
+type Asset struct {
+	Name string
+	URL  string
+}
+
+// GitHubAPI lists the assets of the GitHub releases
+type GitHubAPI interface {
+	// ReleaseAssets returns the assets of the release with the given tag, "latest" refers to the latest release
+	ReleaseAssets(ctx context.Context, user string, repo string, tag string) ([]Asset, error)
+}
+
+// PlingAPI lists the files of the pling.com products
+type PlingAPI interface {
+	// ProductFiles returns the files of the product
+	ProductFiles(ctx context.Context, productId string) ([]Asset, error)
+}
+
+const DefaultGitHubApiUrl = "https://api.github.com"
+const DefaultPlingUrl = "https://www.pling.com"
+
+// GitHubClient is a GitHubAPI using the GitHub REST API
+type GitHubClient struct {
+	// DefaultGitHubApiUrl is used if empty
+	BaseUrl string
+	// optional, sends the requests. Use sources.WithBearerToken to authenticate them
+	HttpClient *sources.HttpClient
+}
+
+func (c *GitHubClient) ReleaseAssets(ctx context.Context, user string, repo string, tag string) ([]Asset, error) {
+	release := "latest"
+	if tag != "latest" {
+		release = "tags/" + url.PathEscape(tag)
+	}
+
+	releaseUrl := fmt.Sprintf("%s/repos/%s/%s/releases/%s", baseUrlOr(c.BaseUrl, DefaultGitHubApiUrl),
+		url.PathEscape(user), url.PathEscape(repo), release)
+
+	var response struct {
+		Assets []struct {
+			Name               string `json:"name"`
+			BrowserDownloadUrl string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+
+	err := getJson(ctx, c.HttpClient, releaseUrl, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []Asset
+	for _, asset := range response.Assets {
+		assets = append(assets, Asset{Name: asset.Name, URL: asset.BrowserDownloadUrl})
+	}
+
+	return assets, nil
+}
+
+// PlingClient is a PlingAPI using the pling.com product files listing
+type PlingClient struct {
+	// DefaultPlingUrl is used if empty
+	BaseUrl string
+	// optional, sends the requests
+	HttpClient *sources.HttpClient
+}
+
+func (c *PlingClient) ProductFiles(ctx context.Context, productId string) ([]Asset, error) {
+	filesUrl := fmt.Sprintf("%s/p/%s/loadFiles", baseUrlOr(c.BaseUrl, DefaultPlingUrl), url.PathEscape(productId))
+
+	var response struct {
+		Files []struct {
+			Name string `json:"name"`
+			// query escaped
+			Url string `json:"url"`
+		} `json:"files"`
+	}
+
+	err := getJson(ctx, c.HttpClient, filesUrl, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []Asset
+	for _, file := range response.Files {
+		fileUrl, err := url.QueryUnescape(file.Url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url for \"%s\": %s", file.Name, err.Error())
+		}
+
+		assets = append(assets, Asset{Name: file.Name, URL: fileUrl})
+	}
+
+	return assets, nil
+}
+
+func getJson(ctx context.Context, client *sources.HttpClient, apiUrl string, target interface{}) error {
+	response, err := client.Get(ctx, apiUrl)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response from \"%s\": %s", apiUrl, response.Status)
+	}
+
+	err = json.NewDecoder(response.Body).Decode(target)
+	if err != nil {
+		return fmt.Errorf("invalid response from \"%s\": %s", apiUrl, err.Error())
+	}
+
+	return nil
+}
+
+func baseUrlOr(baseUrl string, defaultUrl string) string {
+	if baseUrl == "" {
+		return defaultUrl
+	}
+
+	return strings.TrimSuffix(baseUrl, "/")
+}
@@ -0,0 +1,97 @@
+package updateinfo
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/AppImageCrafters/libzsync-go"
+	"github.com/AppImageCrafters/libzsync-go/sources"
+)
+
+// Resolver finds the control file described by the update information
+type Resolver struct {
+	// a GitHubClient is used if nil
+	GitHub GitHubAPI
+	// a PlingClient is used if nil
+	Pling PlingAPI
+	// optional, sends the API, control file and remote file requests
+	HttpClient *sources.HttpClient
+}
+
+// ResolveControlUrl returns the url of the control file described by info
+func (r *Resolver) ResolveControlUrl(ctx context.Context, info UpdateInformation) (string, error) {
+	switch info := info.(type) {
+	case *ZsyncUpdateInfo:
+		return info.URL, nil
+	case *GitHubReleasesUpdateInfo:
+		assets, err := r.gitHub().ReleaseAssets(ctx, info.User, info.Repo, info.Tag)
+		if err != nil {
+			return "", err
+		}
+
+		return findAsset(assets, info.FilePattern, info)
+	case *PlingUpdateInfo:
+		assets, err := r.pling().ProductFiles(ctx, info.ProductId)
+		if err != nil {
+			return "", err
+		}
+
+		return findAsset(assets, info.FilePattern, info)
+	default:
+		return "", fmt.Errorf("unsupported update information: \"%v\"", info)
+	}
+}
+
+// NewZSync resolves the control file url and creates a ZSync from it
+func (r *Resolver) NewZSync(ctx context.Context, info UpdateInformation) (*zsync.ZSync, error) {
+	controlUrl, err := r.ResolveControlUrl(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return zsync.NewZSyncWithClientContext(ctx, controlUrl, r.HttpClient)
+}
+
+// NewZSyncFromAppImage reads the update information of the AppImage at path and creates a ZSync from it
+func NewZSyncFromAppImage(ctx context.Context, appImagePath string) (*zsync.ZSync, error) {
+	info, err := ReadFromAppImage(appImagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := &Resolver{}
+	return resolver.NewZSync(ctx, info)
+}
+
+func (r *Resolver) gitHub() GitHubAPI {
+	if r.GitHub == nil {
+		return &GitHubClient{HttpClient: r.HttpClient}
+	}
+
+	return r.GitHub
+}
+
+func (r *Resolver) pling() PlingAPI {
+	if r.Pling == nil {
+		return &PlingClient{HttpClient: r.HttpClient}
+	}
+
+	return r.Pling
+}
+
+// returns the url of the first asset which name matches pattern
+func findAsset(assets []Asset, pattern string, info UpdateInformation) (string, error) {
+	for _, asset := range assets {
+		matched, err := path.Match(pattern, asset.Name)
+		if err != nil {
+			return "", fmt.Errorf("invalid file pattern \"%s\": %s", pattern, err.Error())
+		}
+
+		if matched {
+			return asset.URL, nil
+		}
+	}
+
+	return "", fmt.Errorf("no file matches \"%s\"", info.String())
+}
@@ -0,0 +1,152 @@
+package updateinfo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/AppImageCrafters/libzsync-go/control"
+	"github.com/stretchr/testify/assert"
+)
+
+// serves a GitHub release, a pling product and the control file they point to
+func newStubServer(t *testing.T) *httptest.Server {
+	content := bytes.Repeat([]byte("0123456789"), 500)
+	var controlFile bytes.Buffer
+	err := control.Make(bytes.NewReader(content), int64(len(content)), &controlFile,
+		control.MakeOptions{FileName: "app-2-x86_64.AppImage"})
+	assert.Nil(t, err)
+
+	mux := http.NewServeMux()
+	var server *httptest.Server
+
+	mux.HandleFunc("/repos/user/repo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"tag_name": "2", "assets": [
+			{"name": "app-2-x86_64.AppImage", "browser_download_url": "%[1]s/download/app-2-x86_64.AppImage"},
+			{"name": "app-2-x86_64.AppImage.zsync", "browser_download_url": "%[1]s/download/app-2-x86_64.AppImage.zsync"}
+		]}`, server.URL)
+	})
+	mux.HandleFunc("/repos/user/repo/releases/tags/1", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"tag_name": "1", "assets": [
+			{"name": "app-1-x86_64.AppImage.zsync", "browser_download_url": "%s/download/app-1-x86_64.AppImage.zsync"}
+		]}`, server.URL)
+	})
+	mux.HandleFunc("/p/1234/loadFiles", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"status": "success", "files": [
+			{"name": "app-2-i386.AppImage.zsync", "url": "%s"},
+			{"name": "app-2-x86_64.AppImage.zsync", "url": "%s"}
+		]}`, url.QueryEscape(server.URL+"/download/app-2-i386.AppImage.zsync"),
+			url.QueryEscape(server.URL+"/download/app-2-x86_64.AppImage.zsync"))
+	})
+	mux.HandleFunc("/download/app-2-x86_64.AppImage.zsync", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(controlFile.Bytes())
+	})
+
+	server = httptest.NewServer(mux)
+	return server
+}
+
+func TestResolver_ResolveControlUrl(t *testing.T) {
+	server := newStubServer(t)
+	defer server.Close()
+
+	resolver := &Resolver{
+		GitHub: &GitHubClient{BaseUrl: server.URL},
+		Pling:  &PlingClient{BaseUrl: server.URL},
+	}
+
+	tests := []struct {
+		info     UpdateInformation
+		expected string
+	}{
+		{&ZsyncUpdateInfo{URL: "https://example.com/app.zsync"}, "https://example.com/app.zsync"},
+		{&GitHubReleasesUpdateInfo{User: "user", Repo: "repo", Tag: "latest", FilePattern: "app-*-x86_64.AppImage.zsync"},
+			server.URL + "/download/app-2-x86_64.AppImage.zsync"},
+		{&GitHubReleasesUpdateInfo{User: "user", Repo: "repo", Tag: "1", FilePattern: "app-*.zsync"},
+			server.URL + "/download/app-1-x86_64.AppImage.zsync"},
+		{&PlingUpdateInfo{ProductId: "1234", FilePattern: "app-*-x86_64.AppImage.zsync"},
+			server.URL + "/download/app-2-x86_64.AppImage.zsync"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.info.String(), func(t *testing.T) {
+			controlUrl, err := resolver.ResolveControlUrl(context.Background(), tt.info)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, controlUrl)
+		})
+	}
+}
+
+func TestResolver_ResolveControlUrlErrors(t *testing.T) {
+	server := newStubServer(t)
+	defer server.Close()
+
+	resolver := &Resolver{
+		GitHub: &GitHubClient{BaseUrl: server.URL},
+		Pling:  &PlingClient{BaseUrl: server.URL},
+	}
+
+	for _, info := range []UpdateInformation{
+		&GitHubReleasesUpdateInfo{User: "user", Repo: "repo", Tag: "latest", FilePattern: "*.deb"},
+		&GitHubReleasesUpdateInfo{User: "user", Repo: "missing", Tag: "latest", FilePattern: "*.zsync"},
+		&GitHubReleasesUpdateInfo{User: "user", Repo: "repo", Tag: "latest", FilePattern: "[.zsync"},
+		&PlingUpdateInfo{ProductId: "4321", FilePattern: "*.zsync"},
+	} {
+		_, err := resolver.ResolveControlUrl(context.Background(), info)
+		assert.NotNil(t, err, info.String())
+	}
+}
+
+type stubGitHubAPI []Asset
+
+func (s stubGitHubAPI) ReleaseAssets(ctx context.Context, user string, repo string, tag string) ([]Asset, error) {
+	return s, nil
+}
+
+func TestResolver_NewZSync(t *testing.T) {
+	server := newStubServer(t)
+	defer server.Close()
+
+	resolver := &Resolver{GitHub: stubGitHubAPI{
+		{Name: "app-2-x86_64.AppImage.zsync", URL: server.URL + "/download/app-2-x86_64.AppImage.zsync"},
+	}}
+
+	info, _ := Parse("gh-releases-zsync|user|repo|latest|app-*-x86_64.AppImage.zsync")
+	zsync, err := resolver.NewZSync(context.Background(), info)
+	assert.Nil(t, err)
+
+	// the URL header defaults to the file name and is resolved against the control file url
+	assert.Equal(t, server.URL+"/download/app-2-x86_64.AppImage", zsync.RemoteFileUrl)
+	assert.Equal(t, int64(5000), zsync.RemoteFileSize)
+}
+
+// cancels the context once the assets are listed
+type cancelingGitHubAPI struct {
+	stubGitHubAPI
+	cancel context.CancelFunc
+}
+
+func (s cancelingGitHubAPI) ReleaseAssets(ctx context.Context, user string, repo string, tag string) ([]Asset, error) {
+	s.cancel()
+	return s.stubGitHubAPI, nil
+}
+
+func TestResolver_NewZSyncCanceled(t *testing.T) {
+	server := newStubServer(t)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resolver := &Resolver{GitHub: cancelingGitHubAPI{cancel: cancel, stubGitHubAPI: stubGitHubAPI{
+		{Name: "app-2-x86_64.AppImage.zsync", URL: server.URL + "/download/app-2-x86_64.AppImage.zsync"},
+	}}}
+
+	info, _ := Parse("gh-releases-zsync|user|repo|latest|app-*-x86_64.AppImage.zsync")
+	_, err := resolver.NewZSync(ctx, info)
+	assert.True(t, errors.Is(err, context.Canceled), err)
+}
@@ -0,0 +1,129 @@
+package updateinfo
+
+/**
+Updateinfo reads and parses the update information embedded in AppImages.
+See https://github.com/AppImage/AppImageSpec/blob/master/draft.md#update-information
+*/
+
+import (
+	"debug/elf"
+	"fmt"
+	"strings"
+)
+
+// section of the AppImage runtime that holds the update information
+const SectionName = ".upd_info"
+
+// UpdateInformation is one of ZsyncUpdateInfo, GitHubReleasesUpdateInfo or PlingUpdateInfo
+type UpdateInformation interface {
+	// String returns the update information as embedded in the AppImage
+	String() string
+}
+
+// ZsyncUpdateInfo points directly to the control file: "zsync|<url>"
+type ZsyncUpdateInfo struct {
+	URL string
+}
+
+func (i *ZsyncUpdateInfo) String() string {
+	return "zsync|" + i.URL
+}
+
+// GitHubReleasesUpdateInfo points to a control file published as a GitHub release asset:
+// "gh-releases-zsync|<user>|<repo>|<tag>|<filename pattern>". The "latest" tag refers to the latest release.
+type GitHubReleasesUpdateInfo struct {
+	User        string
+	Repo        string
+	Tag         string
+	FilePattern string
+}
+
+func (i *GitHubReleasesUpdateInfo) String() string {
+	return strings.Join([]string{"gh-releases-zsync", i.User, i.Repo, i.Tag, i.FilePattern}, "|")
+}
+
+// PlingUpdateInfo points to a control file published in a pling.com product:
+// "pling-v1-zsync|<product id>|<filename pattern>"
+type PlingUpdateInfo struct {
+	ProductId   string
+	FilePattern string
+}
+
+func (i *PlingUpdateInfo) String() string {
+	return strings.Join([]string{"pling-v1-zsync", i.ProductId, i.FilePattern}, "|")
+}
+
+// ReadUpdateInformation reads the raw update information embedded in the AppImage at path
+func ReadUpdateInformation(path string) (string, error) {
+	elfFile, err := elf.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read \"%s\": %s", path, err.Error())
+	}
+	defer elfFile.Close()
+
+	section := elfFile.Section(SectionName)
+	if section == nil {
+		return "", fmt.Errorf("missing %s section in \"%s\"", SectionName, path)
+	}
+
+	data, err := section.Data()
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s section: %s", SectionName, err.Error())
+	}
+
+	// the section has a fixed size, the unused bytes are zeroes
+	value := strings.TrimSpace(strings.Trim(string(data), "\x00"))
+	if value == "" {
+		return "", fmt.Errorf("empty %s section in \"%s\"", SectionName, path)
+	}
+
+	return value, nil
+}
+
+// Parse parses an update information string
+func Parse(value string) (UpdateInformation, error) {
+	parts := strings.Split(strings.TrimSpace(value), "|")
+
+	switch parts[0] {
+	case "zsync":
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid zsync update information: \"%s\"", value)
+		}
+
+		return &ZsyncUpdateInfo{URL: parts[1]}, nil
+	case "gh-releases-zsync":
+		if len(parts) != 5 || hasEmpty(parts) {
+			return nil, fmt.Errorf("invalid gh-releases-zsync update information: \"%s\"", value)
+		}
+
+		return &GitHubReleasesUpdateInfo{User: parts[1], Repo: parts[2], Tag: parts[3], FilePattern: parts[4]}, nil
+	case "pling-v1-zsync":
+		if len(parts) != 3 || hasEmpty(parts) {
+			return nil, fmt.Errorf("invalid pling-v1-zsync update information: \"%s\"", value)
+		}
+
+		return &PlingUpdateInfo{ProductId: parts[1], FilePattern: parts[2]}, nil
+	default:
+		return nil, fmt.Errorf("unsupported update information type: \"%s\"", parts[0])
+	}
+}
+
+// ReadFromAppImage reads and parses the update information embedded in the AppImage at path
+func ReadFromAppImage(path string) (UpdateInformation, error) {
+	value, err := ReadUpdateInformation(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(value)
+}
+
+func hasEmpty(values []string) bool {
+	for _, value := range values {
+		if value == "" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,149 @@
+package updateinfo
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected UpdateInformation
+	}{
+		{"zsync|https://example.com/app.AppImage.zsync",
+			&ZsyncUpdateInfo{URL: "https://example.com/app.AppImage.zsync"}},
+		{"gh-releases-zsync|AppImage|AppImageKit|latest|appimagetool-*-x86_64.AppImage.zsync",
+			&GitHubReleasesUpdateInfo{User: "AppImage", Repo: "AppImageKit", Tag: "latest",
+				FilePattern: "appimagetool-*-x86_64.AppImage.zsync"}},
+		{"pling-v1-zsync|1234567|app-*-x86_64.AppImage.zsync",
+			&PlingUpdateInfo{ProductId: "1234567", FilePattern: "app-*-x86_64.AppImage.zsync"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			info, err := Parse(tt.value)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, info)
+			assert.Equal(t, tt.value, info.String())
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"zsync",
+		"zsync|",
+		"gh-releases-zsync|AppImage|AppImageKit|latest",
+		"gh-releases-zsync|AppImage||latest|*.zsync",
+		"pling-v1-zsync|1234567",
+		"bintray-zsync|user|repo|package|file.zsync",
+	} {
+		_, err := Parse(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+// creates an ELF file containing only the given sections
+func makeElf(sections map[string][]byte) []byte {
+	names := []string{"", ".shstrtab"}
+	for name := range sections {
+		names = append(names, name)
+	}
+
+	var shstrtab bytes.Buffer
+	nameOffsets := map[string]uint32{}
+	for _, name := range names {
+		nameOffsets[name] = uint32(shstrtab.Len())
+		shstrtab.WriteString(name + "\x00")
+	}
+	sections[".shstrtab"] = shstrtab.Bytes()
+
+	headerSize := uint64(binary.Size(elf.Header64{}))
+	var data bytes.Buffer
+	headers := []elf.Section64{{}}
+	for _, name := range names[1:] {
+		sectionType := elf.SHT_PROGBITS
+		if name == ".shstrtab" {
+			sectionType = elf.SHT_STRTAB
+		}
+
+		headers = append(headers, elf.Section64{
+			Name:      nameOffsets[name],
+			Type:      uint32(sectionType),
+			Off:       headerSize + uint64(data.Len()),
+			Size:      uint64(len(sections[name])),
+			Addralign: 1,
+		})
+		data.Write(sections[name])
+	}
+
+	header := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     headerSize + uint64(data.Len()),
+		Ehsize:    uint16(headerSize),
+		Shentsize: uint16(binary.Size(elf.Section64{})),
+		Shnum:     uint16(len(headers)),
+		Shstrndx:  1,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	var file bytes.Buffer
+	_ = binary.Write(&file, binary.LittleEndian, header)
+	file.Write(data.Bytes())
+	_ = binary.Write(&file, binary.LittleEndian, headers)
+
+	return file.Bytes()
+}
+
+func writeTempFile(t *testing.T, data []byte) string {
+	file, err := ioutil.TempFile("", "appimage")
+	assert.Nil(t, err)
+	defer file.Close()
+
+	_, err = file.Write(data)
+	assert.Nil(t, err)
+
+	return file.Name()
+}
+
+func TestReadFromAppImage(t *testing.T) {
+	// the section is padded with zeroes
+	section := make([]byte, 1024)
+	copy(section, "gh-releases-zsync|AppImage|AppImageKit|continuous|appimagetool-x86_64.AppImage.zsync")
+
+	path := writeTempFile(t, makeElf(map[string][]byte{".upd_info": section, ".sha256_sig": make([]byte, 64)}))
+	defer os.Remove(path)
+
+	info, err := ReadFromAppImage(path)
+	assert.Nil(t, err)
+	assert.Equal(t, &GitHubReleasesUpdateInfo{User: "AppImage", Repo: "AppImageKit", Tag: "continuous",
+		FilePattern: "appimagetool-x86_64.AppImage.zsync"}, info)
+}
+
+func TestReadUpdateInformationErrors(t *testing.T) {
+	missingSection := writeTempFile(t, makeElf(map[string][]byte{".sha256_sig": make([]byte, 64)}))
+	defer os.Remove(missingSection)
+
+	emptySection := writeTempFile(t, makeElf(map[string][]byte{".upd_info": make([]byte, 1024)}))
+	defer os.Remove(emptySection)
+
+	notElf := writeTempFile(t, []byte("#!/bin/sh"))
+	defer os.Remove(notElf)
+
+	for _, path := range []string{missingSection, emptySection, notElf, "/non/existent"} {
+		_, err := ReadUpdateInformation(path)
+		assert.NotNil(t, err, path)
+	}
+}
@@ -0,0 +1,105 @@
+package zsync
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/AppImageCrafters/libzsync-go/chunks"
+	"github.com/AppImageCrafters/libzsync-go/sources"
+)
+
+// sequentialWriter writes the output in order, filling it with the chunks mapped from the seeds and the ranges
+// received from the remote file. Data overlapping already written bytes is skipped.
+type sequentialWriter struct {
+	output       io.WriteSeeker
+	mappedChunks []chunks.ChunkInfo
+
+	// bytes written so far
+	offset int64
+}
+
+// writes the mapped chunks that begin before offset
+func (w *sequentialWriter) writeMappedChunksUntil(offset int64) error {
+	for len(w.mappedChunks) > 0 && w.mappedChunks[0].TargetOffset < offset {
+		chunk := trimChunk(w.mappedChunks[0], w.offset)
+		w.mappedChunks = w.mappedChunks[1:]
+
+		if chunk.Size <= 0 {
+			continue
+		}
+
+		if chunk.TargetOffset != w.offset {
+			return fmt.Errorf("missing data at offset: %d", w.offset)
+		}
+
+		err := writeChunk(chunk.Source, w.output, chunk)
+		if err != nil {
+			return err
+		}
+
+		w.offset += chunk.Size
+	}
+
+	return nil
+}
+
+// writeRange is a sources.RangeHandler
+func (w *sequentialWriter) writeRange(byteRange sources.ByteRange, body io.Reader) error {
+	err := w.writeMappedChunksUntil(byteRange.Begin)
+	if err != nil {
+		return err
+	}
+
+	if byteRange.Begin > w.offset {
+		return fmt.Errorf("missing data at offset: %d", w.offset)
+	}
+
+	if byteRange.End <= w.offset {
+		return nil
+	}
+
+	_, err = io.CopyN(ioutil.Discard, body, w.offset-byteRange.Begin)
+	if err != nil {
+		return fmt.Errorf("unable to skip bytes: %s", err.Error())
+	}
+
+	_, err = w.output.Seek(w.offset, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("unable to seek target offset: %d", w.offset)
+	}
+
+	n, err := io.CopyN(w.output, body, byteRange.End-w.offset)
+	w.offset += n
+	if err != nil {
+		return fmt.Errorf("unable to copy bytes: %d %s", n, err.Error())
+	}
+
+	return nil
+}
+
+// writes the remaining mapped chunks and checks that the output is complete
+func (w *sequentialWriter) finish(size int64) error {
+	err := w.writeMappedChunksUntil(size)
+	if err != nil {
+		return err
+	}
+
+	if w.offset != size {
+		return fmt.Errorf("missing data at offset: %d", w.offset)
+	}
+
+	return nil
+}
+
+// removes the chunk bytes before offset
+func trimChunk(chunk chunks.ChunkInfo, offset int64) chunks.ChunkInfo {
+	if chunk.TargetOffset < offset {
+		delta := offset - chunk.TargetOffset
+		chunk.TargetOffset += delta
+		chunk.SourceOffset += delta
+		chunk.Size -= delta
+	}
+
+	return chunk
+}
@@ -12,12 +12,15 @@ See http://zsync.moria.org.uk/
 */
 
 import (
+	"context"
+	"crypto/sha1"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"net/url"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/AppImageCrafters/libzsync-go/chunks"
 	"github.com/AppImageCrafters/libzsync-go/chunksmapper"
@@ -33,16 +36,65 @@ type ZSync struct {
 
 	RemoteFileUrl  string
 	RemoteFileSize int64
+	// alternative locations of the remote file, missing chunks requests are spread across all the urls
+	MirrorUrls []string
+
+	// expected SHA-1 of the output, verification is skipped if empty
+	SHA1               string
+	OnChecksumMismatch MismatchAction
+
+	// optional, receives the sync progress
+	Observer ProgressObserver
+
+	// missing ranges separated by MaxRangeGap bytes or less are downloaded as a single one
+	MaxRangeGap int64
+	// ranges sent per request, DefaultMaxRangesPerRequest is used if 0
+	MaxRangesPerRequest int
+
+	// number of concurrent downloads, only used if the output implements io.WriterAt and io.ReaderAt (like *os.File)
+	DownloadConcurrency int
+	// concurrent connections allowed per host, unlimited if 0
+	MaxConnectionsPerHost int
+
+	// optional, sends the remote file requests
+	HttpClient *sources.HttpClient
+	// optional, failed requests are not retried if nil. See sources.DefaultRetryPolicy
+	RetryPolicy *sources.RetryPolicy
+	// strategy used when the server ignores range requests, RangeRequests disables the fallback
+	RangesFallback DownloadStrategy
+
+	// modification time of the remote file, SyncToFile sets it on the output unless it's zero
+	MTime time.Time
+	// SyncToFile keeps the replaced destination as <destination>.zs-old
+	KeepBackup bool
 }
 
+const DefaultMaxRangesPerRequest = 20
+
 func NewZSync(zsyncFileUrl string) (*ZSync, error) {
-	resp, err := http.Get(zsyncFileUrl)
+	return NewZSyncWithClient(zsyncFileUrl, nil)
+}
+
+// NewZSyncWithClient is like NewZSync but client is used to fetch the control file and the remote file chunks
+func NewZSyncWithClient(zsyncFileUrl string, client *sources.HttpClient) (*ZSync, error) {
+	return NewZSyncWithClientContext(context.Background(), zsyncFileUrl, client)
+}
+
+// NewZSyncWithClientContext is like NewZSyncWithClient but the control file request is canceled once ctx is done
+func NewZSyncWithClientContext(ctx context.Context, zsyncFileUrl string, client *sources.HttpClient) (*ZSync, error) {
+	resp, err := client.Get(ctx, zsyncFileUrl)
 	if err != nil {
 		return nil, err
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unable to get control file \"%s\": %s", zsyncFileUrl, resp.Status)
+	}
+
 	c, err := control.ReadControl(resp.Body)
 	if err != nil {
+		_ = resp.Body.Close()
 		return nil, err
 	}
 
@@ -51,74 +103,264 @@ func NewZSync(zsyncFileUrl string) (*ZSync, error) {
 		return nil, err
 	}
 
-	return &ZSync{
-		BlockSize:      int64(c.BlockSize),
-		ChecksumsIndex: c.ChecksumIndex,
-		RemoteFileUrl:  c.URL,
-		RemoteFileSize: c.FileLength,
-	}, nil
+	zsync := NewZSyncFromControl(c)
+	zsync.HttpClient = client
+	err = zsync.ResolveUrls(zsyncFileUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return zsync, nil
+}
+
+// ResolveUrls resolves the relative RemoteFileUrl and MirrorUrls against the control file url
+func (zsync *ZSync) ResolveUrls(zsyncFileUrl string) (err error) {
+	zsync.RemoteFileUrl, err = resolveUrl(zsyncFileUrl, zsync.RemoteFileUrl)
+	if err != nil {
+		return err
+	}
+
+	for i, mirrorUrl := range zsync.MirrorUrls {
+		zsync.MirrorUrls[i], err = resolveUrl(zsyncFileUrl, mirrorUrl)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolves the URL header of a control file against the control file location, as the zsync C client does
+func resolveUrl(zsyncFileUrl string, fileUrl string) (string, error) {
+	base, err := url.Parse(zsyncFileUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid control file url \"%s\": %s", zsyncFileUrl, err.Error())
+	}
+
+	ref, err := url.Parse(fileUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid file url \"%s\": %s", fileUrl, err.Error())
+	}
+
+	return base.ResolveReference(ref).String(), nil
 }
 
 func NewZSyncFromControl(c *control.Control) *ZSync {
+	// the first URL is the remote file, the others are mirrors
+	var remoteFileUrl string
+	var mirrorUrls []string
+	if urls := c.AllURLs(); len(urls) > 0 {
+		remoteFileUrl, mirrorUrls = urls[0], append([]string(nil), urls[1:]...)
+	}
+
 	return &ZSync{
 		BlockSize:      int64(c.BlockSize),
 		ChecksumsIndex: c.ChecksumIndex,
-		RemoteFileUrl:  c.URL,
+		RemoteFileUrl:  remoteFileUrl,
 		RemoteFileSize: c.FileLength,
+		MirrorUrls:     mirrorUrls,
+		SHA1:           c.SHA1,
+		MTime:          parseMTime(c.MTime),
 	}
 }
 
-func (zsync *ZSync) Sync(filePath string, output io.WriteSeeker) error {
-	reusableChunks, err := zsync.SearchReusableChunks(filePath)
+// parses the MTime header, the zero time is returned if it's missing or invalid
+func parseMTime(value string) time.Time {
+	mtime, err := time.Parse(time.RFC1123Z, value)
 	if err != nil {
-		return err
+		return time.Time{}
 	}
 
-	input, err := os.Open(filePath)
+	return mtime
+}
+
+// Sync writes the remote file into output reusing the chunks found at filePath. The output is written sequentially
+// and its SHA-1 is compared with the expected one, a *ChecksumMismatchError is returned if they differ. The returned
+// totals describe the work done, also when writing the output fails.
+func (zsync *ZSync) Sync(filePath string, output io.WriteSeeker) (SyncTotals, error) {
+	return zsync.SyncContext(context.Background(), filePath, output)
+}
+
+// SyncContext is like Sync but it stops scanning the seed and downloading chunks once ctx is done,
+// ctx.Err() is returned in such case.
+func (zsync *ZSync) SyncContext(ctx context.Context, filePath string, output io.WriteSeeker) (SyncTotals, error) {
+	return zsync.SyncSeedsContext(ctx, []string{filePath}, output)
+}
+
+// SyncSeeds is like Sync but the chunks are searched in several seeds, for example older versions of the remote
+// file or a partial download. Every target block is copied from a single seed.
+func (zsync *ZSync) SyncSeeds(seedPaths []string, output io.WriteSeeker) (SyncTotals, error) {
+	return zsync.SyncSeedsContext(context.Background(), seedPaths, output)
+}
+
+// SyncSeedsContext is like SyncSeeds but it stops scanning the seeds and downloading chunks once ctx is done,
+// ctx.Err() is returned in such case.
+func (zsync *ZSync) SyncSeedsContext(ctx context.Context, seedPaths []string, output io.WriteSeeker) (SyncTotals,
+	error) {
+	seeds, closeSeeds, err := openSeeds(seedPaths)
 	if err != nil {
-		return err
+		return SyncTotals{}, err
 	}
+	defer closeSeeds()
 
-	chunkMapper := chunksmapper.NewFileChunksMapper(zsync.RemoteFileSize)
-	for chunk := range reusableChunks {
-		err = zsync.WriteChunk(input, output, chunk)
-		if err != nil {
-			return err
-		}
+	return zsync.SyncReadersContext(ctx, seeds, output)
+}
 
-		chunkMapper.Add(chunk)
+// SyncReaders is like SyncSeeds but the seeds can be any io.ReaderAt, see OpenSeed and OpenSeedFS
+func (zsync *ZSync) SyncReaders(seeds []Seed, output io.WriteSeeker) (SyncTotals, error) {
+	return zsync.SyncReadersContext(context.Background(), seeds, output)
+}
+
+// SyncReadersContext is like SyncReaders but it stops scanning the seeds and downloading chunks once ctx is done,
+// ctx.Err() is returned in such case.
+func (zsync *ZSync) SyncReadersContext(ctx context.Context, seeds []Seed, output io.WriteSeeker) (SyncTotals, error) {
+	plan, err := zsync.PlanReadersContext(ctx, seeds)
+	if err != nil {
+		return SyncTotals{}, err
 	}
 
-	missingChunksSource := sources.HttpFileSource{URL: zsync.RemoteFileUrl, Size: zsync.RemoteFileSize}
-	missingChunks := chunkMapper.GetMissingChunks()
+	return zsync.ExecuteContext(ctx, plan, output)
+}
 
-	for _, chunk := range missingChunks {
-		// fetch whole chunk to reduce the number of request
-		_, err = missingChunksSource.Seek(chunk.SourceOffset, io.SeekStart)
-		if err != nil {
-			return err
-		}
+func (zsync *ZSync) getMaxRangesPerRequest() int {
+	if zsync.MaxRangesPerRequest > 0 {
+		return zsync.MaxRangesPerRequest
+	}
 
-		err = missingChunksSource.Request(chunk.Size)
-		if err != nil {
-			return err
+	return DefaultMaxRangesPerRequest
+}
+
+func chunksToRanges(chunkList []chunks.ChunkInfo) []sources.ByteRange {
+	ranges := make([]sources.ByteRange, len(chunkList))
+	for i, chunk := range chunkList {
+		ranges[i] = sources.ByteRange{Begin: chunk.SourceOffset, End: chunk.SourceOffset + chunk.Size}
+	}
+
+	return ranges
+}
+
+// splits ranges in groups of at most batchSize elements
+func batchRanges(ranges []sources.ByteRange, batchSize int) [][]sources.ByteRange {
+	var batches [][]sources.ByteRange
+	for len(ranges) > batchSize {
+		batches = append(batches, ranges[:batchSize])
+		ranges = ranges[batchSize:]
+	}
+
+	if len(ranges) > 0 {
+		batches = append(batches, ranges)
+	}
+
+	return batches
+}
+
+// writes the output in order computing its checksum on the fly
+func (zsync *ZSync) writeSequential(ctx context.Context, output io.WriteSeeker,
+	mappedChunks []chunks.ChunkInfo, batches [][]sources.ByteRange, limiter *sources.ConnectionLimiter,
+	validator *sources.RemoteValidator, stats *sources.TransferStats) (string, error) {
+	hashedOutput := &hashedWriteSeeker{output: output, hash: sha1.New()}
+	missingChunksSource := zsync.newRemoteSource(ctx, 0, limiter, validator, stats)
+
+	writer := &sequentialWriter{output: hashedOutput, mappedChunks: mappedChunks}
+	for _, batch := range batches {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
 		}
 
-		err = zsync.WriteChunk(&missingChunksSource, output, chunk)
+		err := missingChunksSource.ReadRanges(batch, writer.writeRange)
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
 
-	return nil
+	err := writer.finish(zsync.RemoteFileSize)
+	if err != nil {
+		return "", err
+	}
+
+	return hashedOutput.SumHex(), nil
+}
+
+// creates a source for the remote file starting by the mirror at firstMirror
+func (zsync *ZSync) newRemoteSource(ctx context.Context, firstMirror int, limiter *sources.ConnectionLimiter,
+	validator *sources.RemoteValidator, stats *sources.TransferStats) *sources.MirroredHttpFileSource {
+	urls := append([]string{zsync.RemoteFileUrl}, zsync.MirrorUrls...)
+	firstMirror = firstMirror % len(urls)
+
+	rotatedUrls := make([]string, 0, len(urls))
+	rotatedUrls = append(rotatedUrls, urls[firstMirror:]...)
+	rotatedUrls = append(rotatedUrls, urls[:firstMirror]...)
+
+	source := sources.NewMirroredHttpFileSource(rotatedUrls, zsync.RemoteFileSize)
+	source.Ctx = ctx
+	source.OnProgress = zsync.notifyDownloadProgress
+	source.Limiter = limiter
+	source.Validator = validator
+	source.HttpClient = zsync.HttpClient
+	source.RetryPolicy = zsync.RetryPolicy
+	source.Stats = stats
+
+	return source
+}
+
+// ctx.Err() takes precedence over the errors caused by the context cancellation
+func contextErrOr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
 }
 
+// SearchReusableChunks scans the file at path looking for chunks of the remote file. Scanning errors are discarded,
+// use SearchReusableChunksContext to receive them.
 func (zsync *ZSync) SearchReusableChunks(path string) (<-chan chunks.ChunkInfo, error) {
-	inputSize, err := zsync.getFileSize(path)
+	chunkChannel, _, err := zsync.SearchReusableChunksContext(context.Background(), path)
+	return chunkChannel, err
+}
+
+// SearchReusableChunksContext is like SearchReusableChunks but the workers stop once ctx is done or once any of them
+// fails. Both returned channels are closed after all the workers exit, the errors channel holds the workers errors.
+// Reaching the end of the file is not considered an error. The chunks Source is nil, the file is closed once the
+// workers exit.
+func (zsync *ZSync) SearchReusableChunksContext(ctx context.Context, path string) (<-chan chunks.ChunkInfo,
+	<-chan error, error) {
+	seed, err := OpenSeed(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	chunkChannel, errorChannel := zsync.searchSeed(ctx, seed, nil, func() { _ = seed.Close() })
+	return chunkChannel, errorChannel, nil
+}
+
+// SearchReusableChunksInSeed is like SearchReusableChunksContext but it scans seed, which is set as the chunks Source
+func (zsync *ZSync) SearchReusableChunksInSeed(ctx context.Context, seed Seed) (<-chan chunks.ChunkInfo,
+	<-chan error) {
+	return zsync.searchSeed(ctx, seed, io.NewSectionReader(seed.Reader, 0, seed.Size), func() {})
+}
+
+// adds the chunks found in seed to chunkMapper, source is set as their Source
+func (zsync *ZSync) mapSeedChunks(ctx context.Context, seed Seed, source io.ReadSeeker,
+	chunkMapper *chunksmapper.ChunksMapper) error {
+	reusableChunks, searchErrors := zsync.searchSeed(ctx, seed, source, func() {})
+
+	chunkMapper.FillChunksMap(reusableChunks)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// the channel is closed without values if there were no errors
+	return <-searchErrors
+}
+
+// Scans seed with several workers, each one reads its own segment. The chunks found have source as Source, if not
+// nil it must support concurrent reads for the parallel writer, like io.SectionReader. done is called once all the
+// workers exit.
+func (zsync *ZSync) searchSeed(ctx context.Context, seed Seed, source io.ReadSeeker, done func()) (
+	<-chan chunks.ChunkInfo, <-chan error) {
+	inputSize := seed.Size
+
 	nChunks := inputSize / zsync.BlockSize
 	if nChunks*zsync.BlockSize < inputSize {
 		nChunks++
@@ -129,10 +371,22 @@ func (zsync *ZSync) SearchReusableChunks(path string) (<-chan chunks.ChunkInfo,
 		nWorkers = nChunks
 	}
 
+	searchCtx, cancelSearch := context.WithCancel(ctx)
+	chunkChannel := make(chan chunks.ChunkInfo)
+	errorChannel := make(chan error, nWorkers)
+
+	if nWorkers == 0 {
+		// empty input
+		cancelSearch()
+		close(chunkChannel)
+		close(errorChannel)
+		done()
+		return chunkChannel, errorChannel
+	}
+
 	nChunksPerWorker := nChunks / nWorkers
 	bytesPerWorker := (nChunksPerWorker * zsync.BlockSize)
 
-	chunkChannel := make(chan chunks.ChunkInfo)
 	var waitGroup sync.WaitGroup
 
 	waitGroup.Add(int(nWorkers))
@@ -149,71 +403,131 @@ func (zsync *ZSync) SearchReusableChunks(path string) (<-chan chunks.ChunkInfo,
 			end = inputSize
 		}
 
-		go zsync.searchReusableChunksAsync(path, begin, end, chunkChannel, &waitGroup)
+		go func(begin int64, end int64) {
+			defer waitGroup.Done()
+
+			err := zsync.searchReusableChunksAsync(searchCtx, seed, source, begin, end, chunkChannel)
+			if err != nil {
+				errorChannel <- err
+				// fail fast
+				cancelSearch()
+			}
+		}(begin, end)
 	}
 
 	go func() {
 		waitGroup.Wait()
+		cancelSearch()
 		close(chunkChannel)
+		close(errorChannel)
+		done()
 	}()
 
-	return chunkChannel, nil
-}
-
-func (zsync *ZSync) getFileSize(filePath string) (int64, error) {
-	inputStat, err := os.Stat(filePath)
-	if err != nil {
-		return -1, err
-	}
-
-	return inputStat.Size(), nil
+	return chunkChannel, errorChannel
 }
 
-func (zsync *ZSync) searchReusableChunksAsync(path string, begin int64, end int64, chunksChan chan<- chunks.ChunkInfo, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	input, err := os.Open(path)
-	if err != nil {
-		return
-	}
-
-	_, err = input.Seek(begin, io.SeekStart)
-	if err != nil {
-		return
-	}
+// scans the seed bytes [begin, end), the chunks found are sent to chunksChan with source as Source
+func (zsync *ZSync) searchReusableChunksAsync(ctx context.Context, seed Seed, source io.ReadSeeker, begin int64,
+	end int64, chunksChan chan<- chunks.ChunkInfo) error {
+	// the blocks beginning before end are read completely
+	input := io.NewSectionReader(seed.Reader, begin, seed.Size-begin)
 
 	nextStep := zsync.BlockSize
 	buf := hasedbuffer.NewHashedBuffer(int(zsync.BlockSize))
+	var previousMatches []chunks.ChunkChecksum
+	notifiedOffset := begin
+
+	for off := begin; off < end && ctx.Err() == nil; off += nextStep {
+		if off-notifiedOffset >= seedScanNotificationStep {
+			zsync.notifySeedScanned(off - notifiedOffset)
+			notifiedOffset = off
+		}
 
-	for off := begin; off < end; off += nextStep {
 		err := zsync.consumeBytes(buf, input, nextStep)
-		if err != nil {
+		if err == io.EOF {
 			break
 		}
 
+		if err != nil {
+			return fmt.Errorf("unable to read %s at offset %d: %w", seed.Name, off, err)
+		}
+
 		weakSum := buf.RollingSum()
 		weakMatches := zsync.ChecksumsIndex.FindWeakChecksum2(weakSum)
 
 		if weakMatches != nil {
 			strongSum := buf.CheckSum()
 			strongMatches := zsync.ChecksumsIndex.FindStrongChecksum2(strongSum, weakMatches)
-			if strongMatches != nil {
-				zsync.createChunks(strongMatches, off, chunksChan)
+			strongMatches = zsync.filterConsecutiveMatches(seed.Reader, off, strongMatches, previousMatches)
+			if len(strongMatches) > 0 {
+				if !zsync.createChunks(ctx, source, strongMatches, off, chunksChan) {
+					break
+				}
 
 				// consume entire block
+				previousMatches = strongMatches
 				nextStep = zsync.BlockSize
 				continue
 			}
 		}
 
 		// just consume 1 byte
+		previousMatches = nil
 		nextStep = 1
 	}
 
-	_ = input.Close()
+	zsync.notifySeedScanned(end - notifiedOffset)
+	return nil
 }
 
-func (zsync *ZSync) consumeBytes(buf *hasedbuffer.HashedRingBuffer, input *os.File, nBytes int64) error {
+// Applies the ConsecutiveMatchNeeded rule. A match is only accepted if it continues a match of the previous block,
+// if it's the last block or if the next input block also matches the next target block.
+func (zsync *ZSync) filterConsecutiveMatches(input io.ReaderAt, offset int64, matches []chunks.ChunkChecksum,
+	previousMatches []chunks.ChunkChecksum) []chunks.ChunkChecksum {
+	if zsync.ChecksumsIndex.ConsecutiveMatchNeeded < 2 {
+		return matches
+	}
+
+	var result []chunks.ChunkChecksum
+	var nextWeakSum, nextStrongSum []byte
+	for _, match := range matches {
+		if match.ChunkOffset+1 >= uint(zsync.ChecksumsIndex.BlockCount) ||
+			(match.ChunkOffset > 0 && containsChunkOffset(previousMatches, match.ChunkOffset-1)) {
+			result = append(result, match)
+			continue
+		}
+
+		if nextStrongSum == nil {
+			nextWeakSum, nextStrongSum = zsync.readBlockChecksums(input, offset+zsync.BlockSize)
+		}
+
+		if zsync.ChecksumsIndex.MatchesBlock(match.ChunkOffset+1, nextWeakSum, nextStrongSum) {
+			result = append(result, match)
+		}
+	}
+
+	return result
+}
+
+func containsChunkOffset(checksums []chunks.ChunkChecksum, chunkOffset uint) bool {
+	for _, checksum := range checksums {
+		if checksum.ChunkOffset == chunkOffset {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Computes the checksums of the block starting at offset, missing bytes are replaced by '0'
+func (zsync *ZSync) readBlockChecksums(input io.ReaderAt, offset int64) (weakSum []byte, strongSum []byte) {
+	buf := hasedbuffer.NewHashedBuffer(int(zsync.BlockSize))
+	_, _ = buf.ReadFull(io.NewSectionReader(input, offset, zsync.BlockSize))
+
+	return buf.RollingSum(), buf.CheckSum()
+}
+
+func (zsync *ZSync) consumeBytes(buf *hasedbuffer.HashedRingBuffer, input io.Reader, nBytes int64) error {
 	if nBytes == zsync.BlockSize {
 		_, err := buf.ReadFull(input)
 		return err
@@ -229,11 +543,13 @@ func (zsync *ZSync) consumeBytes(buf *hasedbuffer.HashedRingBuffer, input *os.Fi
 	return nil
 }
 
-func (zsync *ZSync) createChunks(strongMatches []chunks.ChunkChecksum, offset int64, chunksChan chan<- chunks.ChunkInfo) {
+// sends the chunks to chunksChan, returns false if ctx was done before all of them were sent
+func (zsync *ZSync) createChunks(ctx context.Context, source io.ReadSeeker, strongMatches []chunks.ChunkChecksum,
+	offset int64, chunksChan chan<- chunks.ChunkInfo) bool {
 	for _, match := range strongMatches {
 		newChunk := chunks.ChunkInfo{
 			Size:         zsync.BlockSize,
-			Source:       nil,
+			Source:       source,
 			SourceOffset: offset,
 			TargetOffset: int64(match.ChunkOffset) * zsync.BlockSize,
 		}
@@ -243,11 +559,22 @@ func (zsync *ZSync) createChunks(strongMatches []chunks.ChunkChecksum, offset in
 			newChunk.Size = zsync.RemoteFileSize - newChunk.TargetOffset
 		}
 
-		chunksChan <- newChunk
+		select {
+		case chunksChan <- newChunk:
+			zsync.notifyChunkMatched(newChunk)
+		case <-ctx.Done():
+			return false
+		}
 	}
+
+	return true
 }
 
 func (zsync *ZSync) WriteChunk(source io.ReadSeeker, target io.WriteSeeker, chunk chunks.ChunkInfo) error {
+	return writeChunk(source, target, chunk)
+}
+
+func writeChunk(source io.ReadSeeker, target io.WriteSeeker, chunk chunks.ChunkInfo) error {
 	_, err := source.Seek(chunk.SourceOffset, io.SeekStart)
 	if err != nil {
 		return fmt.Errorf("unable to seek source offset: %d", chunk.SourceOffset)
@@ -260,7 +587,7 @@ func (zsync *ZSync) WriteChunk(source io.ReadSeeker, target io.WriteSeeker, chun
 
 	n, err := io.CopyN(target, source, chunk.Size)
 	if err != nil {
-		return fmt.Errorf("unable to copy bytes: %d %s", n, err.Error())
+		return fmt.Errorf("unable to copy bytes: %d %w", n, err)
 	}
 
 	return nil
@@ -34,7 +34,7 @@ func BenchmarkZSync2_Sync(t *testing.B) {
 			assert.Equal(t, err, nil)
 			defer output.Close()
 
-			err = zsync.Sync(dataDir+tt, output)
+			_, err = zsync.Sync(dataDir+tt, output)
 			if err != nil {
 				t.Fatal(err)
 			}
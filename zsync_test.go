@@ -2,22 +2,27 @@ package zsync
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/AppImageCrafters/libzsync-go/chunks"
 	"github.com/AppImageCrafters/libzsync-go/control"
+	"github.com/AppImageCrafters/libzsync-go/sources"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -133,9 +138,13 @@ func writeStringToFile(baseFilePath string, baseString []byte) error {
 }
 
 func makeZsyncFile(baseFileName string, err error) string {
-	cmd := exec.Command("zsyncmake", baseFileName)
-	cmd.Dir = filepath.Dir(baseFileName)
-	err = cmd.Run()
+	output, err := os.Create(baseFileName + ".zsync")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer output.Close()
+
+	err = control.MakeFromFile(baseFileName, output, control.MakeOptions{})
 	if err != nil {
 		fmt.Print(err)
 	}
@@ -164,7 +173,7 @@ func TestZSync2_Sync(t *testing.T) {
 			assert.Equal(t, err, nil)
 			defer output.Close()
 
-			err = zsync.Sync(dataDir+tt, output)
+			_, err = zsync.Sync(dataDir+tt, output)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -178,6 +187,799 @@ func TestZSync2_Sync(t *testing.T) {
 	}
 }
 
+// serves dataDir recording the Range headers, multiple ranges requests are answered with the whole file if
+// multiRangeSupported is false
+func newRangesRecordingServer(multiRangeSupported bool) (*httptest.Server, *[]string) {
+	var requestedRanges []string
+	fileServer := http.FileServer(http.Dir(dataDir))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedRanges = append(requestedRanges, r.Header.Get("Range"))
+		if !multiRangeSupported && strings.Contains(r.Header.Get("Range"), ",") {
+			r.Header.Del("Range")
+		}
+
+		fileServer.ServeHTTP(w, r)
+	}))
+
+	return server, &requestedRanges
+}
+
+func TestZSync2_SyncMultipleRanges(t *testing.T) {
+	tests := []struct {
+		name                string
+		multiRangeSupported bool
+		maxRangesPerRequest int
+		maxRangeGap         int64
+		expectedRanges      []string
+	}{
+		{"multipart", true, 0, 0, []string{"bytes=0-2047,4096-4155"}},
+		{"single range requests", true, 1, 0, []string{"bytes=0-2047", "bytes=4096-4155"}},
+		{"coalesced", true, 0, 2048, []string{"bytes=0-4155"}},
+		{"multipart unsupported", false, 0, 0, []string{"bytes=0-2047,4096-4155", "bytes=0-2047", "bytes=4096-4155"}},
+	}
+
+	// 1st and 3rd chunks changed
+	seedPath := dataDir + "/1st_and_3rd_chunks_changed"
+	_ = GenerateSampleFile([]byte("x1y"), 2048*2+60, 0, seedPath)
+	defer os.Remove(seedPath)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requestedRanges := newRangesRecordingServer(tt.multiRangeSupported)
+			defer server.Close()
+
+			zsyncControl, _ := getControl("file.zsync")
+			zsyncControl.URL = server.URL + "/file"
+			zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+
+			zsync := NewZSyncFromControl(zsyncControl)
+			zsync.MaxRangesPerRequest = tt.maxRangesPerRequest
+			zsync.MaxRangeGap = tt.maxRangeGap
+
+			output := &bytesWriteSeeker{}
+			_, err := zsync.Sync(seedPath, output)
+			assert.Nil(t, err)
+
+			expected, _ := ioutil.ReadFile(dataDir + "/file")
+			assert.Equal(t, expected, output.data)
+			assert.Equal(t, tt.expectedRanges, *requestedRanges)
+		})
+	}
+}
+
+func TestZSync2_SyncRemoteChanged(t *testing.T) {
+	seedPath := dataDir + "/1st_and_3rd_chunks_changed"
+	_ = GenerateSampleFile([]byte("x1y"), 2048*2+60, 0, seedPath)
+	defer os.Remove(seedPath)
+
+	var ifRanges []string
+	fileServer := http.FileServer(http.Dir(dataDir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the file is replaced after the first request
+		if len(ifRanges) == 0 {
+			w.Header().Set("ETag", "\"v1\"")
+		} else {
+			w.Header().Set("ETag", "\"v2\"")
+		}
+
+		ifRanges = append(ifRanges, r.Header.Get("If-Range"))
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = server.URL + "/file"
+	zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+
+	zsync := NewZSyncFromControl(zsyncControl)
+	zsync.MaxRangesPerRequest = 1
+
+	_, err := zsync.Sync(seedPath, &bytesWriteSeeker{})
+	assert.True(t, errors.Is(err, sources.ErrRemoteChanged), err)
+	assert.Equal(t, []string{"", "\"v1\""}, ifRanges)
+}
+
+func TestZSync2_SyncRangesFallback(t *testing.T) {
+	tests := []struct {
+		fallback            DownloadStrategy
+		downloadConcurrency int
+		expectedDownloaded  int64
+	}{
+		{StreamMissingRanges, 0, 2048 + 60},
+		{StreamMissingRanges, 2, 2048 + 60},
+		{DownloadWholeFile, 0, 2048*2 + 60},
+	}
+
+	seedPath := dataDir + "/1st_and_3rd_chunks_changed"
+	_ = GenerateSampleFile([]byte("x1y"), 2048*2+60, 0, seedPath)
+	defer os.Remove(seedPath)
+
+	expected, _ := ioutil.ReadFile(dataDir + "/file")
+
+	var requestedRanges []string
+	var mutex sync.Mutex
+	fileServer := http.FileServer(http.Dir(dataDir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// ranges are ignored
+		mutex.Lock()
+		requestedRanges = append(requestedRanges, r.Header.Get("Range"))
+		mutex.Unlock()
+		r.Header.Del("Range")
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = server.URL + "/file"
+	zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+
+	t.Run("disabled", func(t *testing.T) {
+		zsync := NewZSyncFromControl(zsyncControl)
+
+		_, err := zsync.Sync(seedPath, &bytesWriteSeeker{})
+		assert.True(t, errors.Is(err, sources.ErrRangeNotSupported), err)
+	})
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %d", tt.fallback, tt.downloadConcurrency), func(t *testing.T) {
+			mutex.Lock()
+			requestedRanges = nil
+			mutex.Unlock()
+			observer := &recordingObserver{downloaded: map[int64]int64{}}
+			zsync := NewZSyncFromControl(zsyncControl)
+			zsync.RangesFallback = tt.fallback
+			zsync.DownloadConcurrency = tt.downloadConcurrency
+			zsync.MaxRangesPerRequest = 1
+			zsync.Observer = observer
+
+			outputPath := dataDir + "/file_fallback"
+			output, _ := os.Create(outputPath)
+			defer os.Remove(outputPath)
+			defer output.Close()
+
+			_, err := zsync.Sync(seedPath, output)
+			assert.Nil(t, err)
+
+			result, _ := ioutil.ReadFile(outputPath)
+			assert.Equal(t, expected, result)
+
+			assert.Equal(t, tt.fallback, observer.totals.Strategy)
+			assert.Equal(t, tt.expectedDownloaded, observer.totals.DownloadedBytes)
+			// the whole file is requested once after the ranged request fails, a concurrent ranged request may still
+			// arrive after it
+			wholeFileRequests := 0
+			mutex.Lock()
+			for _, requested := range requestedRanges {
+				if requested == "" {
+					wholeFileRequests++
+				}
+			}
+			mutex.Unlock()
+			assert.Equal(t, 1, wholeFileRequests)
+		})
+	}
+}
+
+func TestZSync2_SyncSeeds(t *testing.T) {
+	expected, _ := ioutil.ReadFile(dataDir + "/file")
+
+	// overlapping seeds, together they contain the whole file
+	firstSeed := dataDir + "/first_seed"
+	_ = ioutil.WriteFile(firstSeed, expected[:4096], 0644)
+	defer os.Remove(firstSeed)
+
+	secondSeed := dataDir + "/second_seed"
+	_ = ioutil.WriteFile(secondSeed, expected[1000:], 0644)
+	defer os.Remove(secondSeed)
+
+	tests := []struct {
+		name                string
+		seeds               []string
+		downloadConcurrency int
+		expectedRanges      []string
+		expectedScanned     int64
+	}{
+		{"no seeds", nil, 0, []string{"bytes=0-4155"}, 0},
+		{"overlapping seeds", []string{firstSeed, secondSeed}, 0, nil, 4096 + 3156},
+		{"overlapping seeds parallel", []string{firstSeed, secondSeed}, 2, nil, 4096 + 3156},
+		{"one seed", []string{firstSeed}, 0, []string{"bytes=4096-4155"}, 4096},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requestedRanges := newRangesRecordingServer(true)
+			defer server.Close()
+
+			zsyncControl, _ := getControl("file.zsync")
+			zsyncControl.URL = server.URL + "/file"
+
+			observer := &recordingObserver{downloaded: map[int64]int64{}}
+			zsync := NewZSyncFromControl(zsyncControl)
+			zsync.DownloadConcurrency = tt.downloadConcurrency
+			zsync.Observer = observer
+
+			outputPath := dataDir + "/file_seeds"
+			output, _ := os.Create(outputPath)
+			defer os.Remove(outputPath)
+			defer output.Close()
+
+			_, err := zsync.SyncSeeds(tt.seeds, output)
+			assert.Nil(t, err)
+
+			result, _ := ioutil.ReadFile(outputPath)
+			assert.Equal(t, expected, result)
+			assert.Equal(t, tt.expectedRanges, *requestedRanges)
+			assert.Equal(t, tt.expectedScanned, observer.totals.SeedBytesScanned)
+		})
+	}
+}
+
+func TestZSync2_SyncReaders(t *testing.T) {
+	expected, _ := ioutil.ReadFile(dataDir + "/file")
+
+	server, requestedRanges := newRangesRecordingServer(true)
+	defer server.Close()
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = server.URL + "/file"
+
+	// in memory seeds
+	seeds := []Seed{
+		NewSeed("first", bytes.NewReader(expected[:4096]), 4096),
+		NewSeed("second", bytes.NewReader(expected[2048:]), int64(len(expected)-2048)),
+	}
+
+	output := &bytesWriteSeeker{}
+	zsync := NewZSyncFromControl(zsyncControl)
+	_, err := zsync.SyncReaders(seeds, output)
+	assert.Nil(t, err)
+
+	assert.Equal(t, expected, output.data)
+	assert.Empty(t, *requestedRanges)
+}
+
+func TestZSync2_SyncToFile(t *testing.T) {
+	expected, _ := ioutil.ReadFile(dataDir + "/file")
+	seedPath := dataDir + "/seed_to_file"
+	_ = GenerateSampleFile([]byte("x1y"), 2048*2+60, 0, seedPath)
+	assert.Nil(t, os.Chmod(seedPath, 0755))
+	defer os.Remove(seedPath)
+
+	destPath := dataDir + "/file_dest"
+	assert.Nil(t, ioutil.WriteFile(destPath, []byte("previous"), 0644))
+	defer os.Remove(destPath)
+	defer os.Remove(destPath + BackupSuffix)
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = serverUrl + "file"
+	zsyncControl.MTime = "Sat, 03 Oct 2020 10:20:30 +0000"
+	zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+
+	zsync := NewZSyncFromControl(zsyncControl)
+	zsync.KeepBackup = true
+	_, err := zsync.SyncToFile(seedPath, destPath)
+	assert.Nil(t, err)
+
+	output, _ := ioutil.ReadFile(destPath)
+	assert.Equal(t, expected, output)
+
+	stat, err := os.Stat(destPath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), stat.Mode().Perm())
+	assert.True(t, stat.ModTime().Equal(time.Date(2020, 10, 3, 10, 20, 30, 0, time.UTC)))
+
+	backup, _ := ioutil.ReadFile(destPath + BackupSuffix)
+	assert.Equal(t, []byte("previous"), backup)
+
+	_, err = os.Stat(destPath + PartialSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestZSync2_SyncToFileFailure(t *testing.T) {
+	destPath := dataDir + "/file_dest_failure"
+	assert.Nil(t, ioutil.WriteFile(destPath, []byte("previous"), 0644))
+	defer os.Remove(destPath)
+	defer os.Remove(destPath + PartialSuffix)
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = serverUrl + "missing_file"
+
+	zsync := NewZSyncFromControl(zsyncControl)
+	_, err := zsync.SyncToFile(dataDir+"/all_changed", destPath)
+	assert.NotNil(t, err)
+
+	// the destination is untouched and the partial output is kept for the next sync
+	output, _ := ioutil.ReadFile(destPath)
+	assert.Equal(t, []byte("previous"), output)
+
+	_, err = os.Stat(destPath + PartialSuffix)
+	assert.Nil(t, err)
+}
+
+func TestZSync2_SyncToFileResume(t *testing.T) {
+	expected, _ := ioutil.ReadFile(dataDir + "/file")
+
+	tests := []struct {
+		name           string
+		partial        []byte
+		expectedRanges []string
+	}{
+		{"first blocks complete", append(append([]byte{}, expected[:4096]...), "garbage"...),
+			[]string{"bytes=4096-4155"}},
+		{"corrupted block", append(append(append([]byte{}, expected[:2048]...), make([]byte, 2048)...),
+			expected[4096:]...), []string{"bytes=2048-4095"}},
+		{"longer than the remote file", append(append([]byte{}, expected...), "garbage"...), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requestedRanges := newRangesRecordingServer(true)
+			defer server.Close()
+
+			destPath := dataDir + "/file_dest_resume"
+			assert.Nil(t, ioutil.WriteFile(destPath+PartialSuffix, tt.partial, 0644))
+			defer os.Remove(destPath)
+
+			zsyncControl, _ := getControl("file.zsync")
+			zsyncControl.URL = server.URL + "/file"
+
+			zsync := NewZSyncFromControl(zsyncControl)
+			_, err := zsync.SyncToFile(dataDir+"/all_changed", destPath)
+			assert.Nil(t, err)
+
+			output, _ := ioutil.ReadFile(destPath)
+			assert.Equal(t, expected, output)
+			assert.Equal(t, tt.expectedRanges, *requestedRanges)
+		})
+	}
+}
+
+func TestZSync2_SyncParallel(t *testing.T) {
+	tests := []struct {
+		maxConnectionsPerHost int
+		expectedMaxActive     int32
+	}{
+		{1, 1},
+		{0, 2},
+	}
+
+	seedPath := dataDir + "/1st_and_3rd_chunks_changed"
+	_ = GenerateSampleFile([]byte("x1y"), 2048*2+60, 0, seedPath)
+	defer os.Remove(seedPath)
+
+	for _, tt := range tests {
+		var active, maxActive int32
+		requestsBarrier := make(chan bool)
+		fileServer := http.FileServer(http.Dir(dataDir))
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			current := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				max := atomic.LoadInt32(&maxActive)
+				if current <= max || atomic.CompareAndSwapInt32(&maxActive, max, current) {
+					break
+				}
+			}
+
+			// give the other worker a chance to send its request
+			select {
+			case requestsBarrier <- true:
+			case <-requestsBarrier:
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			fileServer.ServeHTTP(w, r)
+		}))
+
+		zsyncControl, _ := getControl("file.zsync")
+		zsyncControl.URL = server.URL + "/file"
+		zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+
+		zsync := NewZSyncFromControl(zsyncControl)
+		zsync.MaxRangesPerRequest = 1
+		zsync.DownloadConcurrency = 2
+		zsync.MaxConnectionsPerHost = tt.maxConnectionsPerHost
+
+		outputPath := dataDir + "/file_copy"
+		output, err := os.Create(outputPath)
+		assert.Nil(t, err)
+
+		_, err = zsync.Sync(seedPath, output)
+		assert.Nil(t, err)
+		_ = output.Close()
+		server.Close()
+
+		expected, _ := ioutil.ReadFile(dataDir + "/file")
+		result, _ := ioutil.ReadFile(outputPath)
+		assert.Equal(t, expected, result)
+		assert.Equal(t, tt.expectedMaxActive, maxActive)
+
+		_ = os.Remove(outputPath)
+	}
+}
+
+func TestNewZSyncFromControl_OverriddenURL(t *testing.T) {
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URLs = []string{"file", "http://mirror.example.com/file"}
+
+	// URL replaces the first URL header, the stale one isn't a mirror
+	zsyncControl.URL = "http://cdn.example.com/file"
+	zsync := NewZSyncFromControl(zsyncControl)
+	assert.Equal(t, "http://cdn.example.com/file", zsync.RemoteFileUrl)
+	assert.Equal(t, []string{"http://mirror.example.com/file"}, zsync.MirrorUrls)
+
+	zsyncControl.URL = ""
+	zsync = NewZSyncFromControl(zsyncControl)
+	assert.Equal(t, "file", zsync.RemoteFileUrl)
+	assert.Equal(t, []string{"http://mirror.example.com/file"}, zsync.MirrorUrls)
+
+	// the mirrors are resolved without changing the control file
+	assert.Nil(t, zsync.ResolveUrls("http://example.com/dir/file.zsync"))
+	assert.Equal(t, []string{"file", "http://mirror.example.com/file"}, zsyncControl.URLs)
+}
+
+func TestZSync2_SyncMirrorFailover(t *testing.T) {
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = serverUrl + "missing_file"
+	zsyncControl.URLs = []string{zsyncControl.URL, "http://localhost:1/file", serverUrl + "file"}
+
+	zsync := NewZSyncFromControl(zsyncControl)
+	assert.Equal(t, []string{"http://localhost:1/file", serverUrl + "file"}, zsync.MirrorUrls)
+
+	outputPath := dataDir + "/file_copy"
+	output, err := os.Create(outputPath)
+	assert.Equal(t, err, nil)
+	defer output.Close()
+
+	_, err = zsync.Sync(dataDir+"/all_changed", output)
+	assert.Nil(t, err)
+
+	expected, _ := ioutil.ReadFile(dataDir + "/file")
+	result, _ := ioutil.ReadFile(outputPath)
+	assert.Equal(t, expected, result)
+
+	_ = os.Remove(outputPath)
+}
+
+func TestZSync2_SyncContextCancelled(t *testing.T) {
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = serverUrl + "file"
+	zsync := NewZSyncFromControl(zsyncControl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := zsync.SyncContext(ctx, dataDir+"/large_file", &bytesWriteSeeker{})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestZSync2_SyncContextCancelledWhileDownloading(t *testing.T) {
+	requestReceived := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestReceived <- true
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = server.URL + "/file"
+	zsync := NewZSyncFromControl(zsyncControl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-requestReceived
+		cancel()
+	}()
+
+	_, err := zsync.SyncContext(ctx, dataDir+"/all_changed", &bytesWriteSeeker{})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestZSync2_SearchReusableChunksContextCancelled(t *testing.T) {
+	zsyncControl, _ := getControl("file.zsync")
+	zsync := NewZSyncFromControl(zsyncControl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chunkChan, _, err := zsync.SearchReusableChunksContext(ctx, dataDir+"/large_file")
+	assert.Nil(t, err)
+	cancel()
+
+	select {
+	case <-drain(chunkChan):
+	case <-time.After(5 * time.Second):
+		t.Fatal("chunks channel was not closed")
+	}
+}
+
+func TestZSync2_SearchReusableChunksContextErrors(t *testing.T) {
+	zsyncControl, _ := getControl("file.zsync")
+	zsync := NewZSyncFromControl(zsyncControl)
+
+	_, _, err := zsync.SearchReusableChunksContext(context.Background(), dataDir)
+	assert.NotNil(t, err)
+
+	// reading the seed fails after the scan started
+	seed := NewSeed("failing", failingReaderAt{}, 4*zsync.BlockSize)
+	chunkChan, errChan := zsync.SearchReusableChunksInSeed(context.Background(), seed)
+
+	<-drain(chunkChan)
+	err = <-errChan
+	assert.True(t, errors.Is(err, errFailingReaderAt), err)
+
+	_, err = zsync.Sync(dataDir, &bytesWriteSeeker{})
+	assert.NotNil(t, err)
+
+	_, err = zsync.SyncReaders([]Seed{seed}, &bytesWriteSeeker{})
+	assert.True(t, errors.Is(err, errFailingReaderAt), err)
+}
+
+var errFailingReaderAt = errors.New("read failed")
+
+type failingReaderAt struct{}
+
+func (f failingReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	return 0, errFailingReaderAt
+}
+
+func TestZSync2_SearchReusableChunksEmptyFile(t *testing.T) {
+	zsyncControl, _ := getControl("file.zsync")
+	zsync := NewZSyncFromControl(zsyncControl)
+
+	emptyFilePath := dataDir + "/empty_file"
+	_ = writeStringToFile(emptyFilePath, []byte{})
+	defer os.Remove(emptyFilePath)
+
+	chunkChan, errChan, err := zsync.SearchReusableChunksContext(context.Background(), emptyFilePath)
+	assert.Nil(t, err)
+
+	<-drain(chunkChan)
+	assert.Nil(t, <-errChan)
+}
+
+func drain(chunkChan <-chan chunks.ChunkInfo) <-chan bool {
+	done := make(chan bool)
+	go func() {
+		for range chunkChan {
+		}
+		close(done)
+	}()
+
+	return done
+}
+
+// in memory io.WriteSeeker
+type bytesWriteSeeker struct {
+	data   []byte
+	offset int64
+}
+
+func (b *bytesWriteSeeker) Write(p []byte) (n int, err error) {
+	end := b.offset + int64(len(p))
+	if end > int64(len(b.data)) {
+		b.data = append(b.data, make([]byte, end-int64(len(b.data)))...)
+	}
+
+	copy(b.data[b.offset:], p)
+	b.offset = end
+	return len(p), nil
+}
+
+func (b *bytesWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		b.offset = offset
+	case io.SeekCurrent:
+		b.offset += offset
+	case io.SeekEnd:
+		b.offset = int64(len(b.data)) + offset
+	}
+
+	return b.offset, nil
+}
+
+type recordingObserver struct {
+	mutex         sync.Mutex
+	seedScanned   int64
+	chunksMatched int
+	reusedBytes   int64
+	missingBytes  int64
+	downloaded    map[int64]int64
+	totals        *SyncTotals
+}
+
+func (o *recordingObserver) OnSeedScanned(n int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.seedScanned += n
+}
+
+func (o *recordingObserver) OnChunkMatched(chunk chunks.ChunkInfo) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.chunksMatched++
+}
+
+func (o *recordingObserver) OnSyncPlanned(reusedBytes int64, missingBytes int64) {
+	o.reusedBytes = reusedBytes
+	o.missingBytes = missingBytes
+}
+
+func (o *recordingObserver) OnDownloadProgress(rangeBegin int64, rangeEnd int64, received int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.downloaded[rangeBegin] = received
+}
+
+func (o *recordingObserver) OnSyncFinished(totals SyncTotals) {
+	o.totals = &totals
+}
+
+func TestZSync2_SyncProgress(t *testing.T) {
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = serverUrl + "file"
+
+	observer := &recordingObserver{downloaded: map[int64]int64{}}
+	zsync := NewZSyncFromControl(zsyncControl)
+	zsync.Observer = observer
+
+	totals, err := zsync.Sync(dataDir+"/1st_chunk_changed", &bytesWriteSeeker{})
+	assert.Nil(t, err)
+	assert.Equal(t, &totals, observer.totals)
+
+	assert.Equal(t, int64(2048*2+60), observer.seedScanned)
+	assert.Equal(t, 2, observer.chunksMatched)
+	assert.Equal(t, int64(2048+60), observer.reusedBytes)
+	assert.Equal(t, int64(2048), observer.missingBytes)
+	assert.Equal(t, map[int64]int64{0: 2048}, observer.downloaded)
+
+	assert.True(t, totals.ScanDuration > 0)
+	assert.True(t, totals.DownloadDuration > 0)
+	totals.ScanDuration, totals.DownloadDuration, totals.VerifyDuration = 0, 0, 0
+	assert.Equal(t, SyncTotals{
+		SeedBytesScanned: 2048*2 + 60,
+		MatchedChunks:    2,
+		MatchedBytes:     2048 + 60,
+		ReusedBytes:      2048 + 60,
+		DownloadedBytes:  2048,
+		HttpRequests:     1,
+		ReceivedBytes:    2048,
+	}, totals)
+}
+
+func TestZSync2_SyncTotalsOverhead(t *testing.T) {
+	seedPath := dataDir + "/1st_and_3rd_chunks_changed"
+	_ = GenerateSampleFile([]byte("x1y"), 2048*2+60, 0, seedPath)
+	defer os.Remove(seedPath)
+
+	server, requestedRanges := newRangesRecordingServer(true)
+	defer server.Close()
+
+	zsyncControl, _ := getControl("file.zsync")
+	zsyncControl.URL = server.URL + "/file"
+	zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = 1
+
+	// the matched 2nd chunk is downloaded along with its neighbours
+	zsync := NewZSyncFromControl(zsyncControl)
+	zsync.MaxRangeGap = 2048
+	totals, err := zsync.Sync(seedPath, &bytesWriteSeeker{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"bytes=0-4155"}, *requestedRanges)
+	assert.Equal(t, int64(2048), totals.MatchedBytes)
+	assert.Equal(t, int64(0), totals.ReusedBytes)
+	assert.Equal(t, int64(2048*2+60), totals.DownloadedBytes)
+	assert.Equal(t, 1, totals.HttpRequests)
+	assert.Equal(t, int64(2048*2+60), totals.ReceivedBytes)
+	assert.Equal(t, int64(2048), totals.OverheadBytes)
+}
+
+func TestZSync2_SyncChecksumMismatch(t *testing.T) {
+	tests := []struct {
+		action          MismatchAction
+		outputExists    bool
+		quarantineExist bool
+	}{
+		{KeepMismatchedOutput, true, false},
+		{RemoveMismatchedOutput, false, false},
+		{QuarantineMismatchedOutput, false, true},
+	}
+
+	for _, tt := range tests {
+		zsyncControl, _ := getControl("file.zsync")
+		zsyncControl.URL = serverUrl + "file"
+
+		zsync := NewZSyncFromControl(zsyncControl)
+		zsync.SHA1 = "0000000000000000000000000000000000000000"
+		zsync.OnChecksumMismatch = tt.action
+
+		outputPath := dataDir + "/file_copy"
+		output, err := os.Create(outputPath)
+		assert.Equal(t, err, nil)
+
+		_, err = zsync.Sync(dataDir+"/1st_chunk_changed", output)
+		_ = output.Close()
+
+		var mismatchErr *ChecksumMismatchError
+		if assert.True(t, errors.As(err, &mismatchErr)) {
+			assert.Equal(t, zsyncControl.SHA1, mismatchErr.Actual)
+		}
+
+		_, err = os.Stat(outputPath)
+		assert.Equal(t, tt.outputExists, err == nil)
+		_, err = os.Stat(outputPath + QuarantineSuffix)
+		assert.Equal(t, tt.quarantineExist, err == nil)
+
+		_ = os.Remove(outputPath)
+		_ = os.Remove(outputPath + QuarantineSuffix)
+	}
+}
+
+func TestNewZSync(t *testing.T) {
+	zsync, err := NewZSync(serverUrl + "file.zsync")
+	assert.Nil(t, err)
+
+	assert.Equal(t, serverUrl+"file", zsync.RemoteFileUrl)
+	assert.Equal(t, int64(2048*2+60), zsync.RemoteFileSize)
+}
+
+func TestNewZSyncWithClient(t *testing.T) {
+	fileServer := http.FileServer(http.Dir(dataDir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "user" || password != "secret" || r.UserAgent() != "libzsync-go-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	_, err := NewZSync(server.URL + "/file.zsync")
+	assert.NotNil(t, err)
+
+	client := &sources.HttpClient{
+		Client: &http.Client{Timeout: 10 * time.Second},
+		ModifyRequest: sources.ChainRequestModifiers(
+			sources.WithBasicAuth("user", "secret"),
+			sources.WithHeaders(map[string]string{"User-Agent": "libzsync-go-test"}),
+		),
+	}
+
+	zsync, err := NewZSyncWithClient(server.URL+"/file.zsync", client)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, server.URL+"/file", zsync.RemoteFileUrl)
+
+	output := &bytesWriteSeeker{}
+	_, err = zsync.Sync(dataDir+"/1st_chunk_changed", output)
+	assert.Nil(t, err)
+
+	expected, _ := ioutil.ReadFile(dataDir + "/file")
+	assert.Equal(t, expected, output.data)
+}
+
+func TestResolveUrl(t *testing.T) {
+	tests := []struct {
+		fileUrl  string
+		expected string
+	}{
+		{"file.AppImage", "http://example.com/releases/v1/file.AppImage"},
+		{"../v2/file.AppImage", "http://example.com/releases/v2/file.AppImage"},
+		{"/mirror/file.AppImage", "http://example.com/mirror/file.AppImage"},
+		{"//cdn.example.com/file.AppImage", "http://cdn.example.com/file.AppImage"},
+		{"https://mirror.example.com/file.AppImage", "https://mirror.example.com/file.AppImage"},
+	}
+
+	for _, tt := range tests {
+		result, err := resolveUrl("http://example.com/releases/v1/file.AppImage.zsync", tt.fileUrl)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, result)
+	}
+}
+
 func TestZSync2_SearchReusableChunks(t *testing.T) {
 	zsyncControl, _ := getControl("file.zsync")
 	zsyncControl.URL = serverUrl + "file"
@@ -203,6 +1005,43 @@ func TestZSync2_SearchReusableChunks(t *testing.T) {
 
 		assert.Equal(t, int64(60), results[1].Size)
 		assert.Equal(t, int64(zsyncControl.BlockSize*2), results[1].SourceOffset)
+
+		// the seed is closed once the search ends
+		assert.Nil(t, results[0].Source)
+		assert.Nil(t, results[1].Source)
+	}
+}
+
+func TestZSync2_SearchReusableChunksConsecutiveMatches(t *testing.T) {
+	tests := []struct {
+		consecutiveMatchNeeded uint
+		expectedTargets        []int64
+	}{
+		{1, []int64{0}},
+		{2, nil},
+	}
+
+	// the first block is followed by a changed one
+	seedPath := dataDir + "/1st_chunk_unconfirmed"
+	_ = GenerateSampleFile([]byte("0x"), 2048*2, 0, seedPath)
+	defer os.Remove(seedPath)
+
+	for _, tt := range tests {
+		zsyncControl, _ := getControl("file.zsync")
+		zsyncControl.ChecksumIndex.ConsecutiveMatchNeeded = tt.consecutiveMatchNeeded
+
+		zsync := NewZSyncFromControl(zsyncControl)
+
+		var results []int64
+		chunkChan, err := zsync.SearchReusableChunks(seedPath)
+		assert.Nil(t, err)
+
+		for chunk := range chunkChan {
+			results = append(results, chunk.TargetOffset)
+		}
+		sort.SliceStable(results, func(i, j int) bool { return results[i] < results[j] })
+
+		assert.Equal(t, tt.expectedTargets, results)
 	}
 }
 